@@ -0,0 +1,471 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// configFileNames are the config files looked up in the project root, in order of precedence
+var configFileNames = []string{"pulse.toml", "pulse.yaml", "pulse.yml"}
+
+// settings holds the options that can be set in a config file, either at the
+// top level or inside a named profile.
+type settings struct {
+	Package        string              `toml:"package" yaml:"package"`
+	WatchDirs      []string            `toml:"watch_dirs" yaml:"watch_dirs"`
+	Excludes       []string            `toml:"excludes" yaml:"excludes"`
+	DefaultIgnores *bool               `toml:"default_ignores" yaml:"default_ignores"`
+	BuildArgs      []string            `toml:"build_args" yaml:"build_args"`
+	PrebuildCmd    string              `toml:"prebuild_cmd" yaml:"prebuild_cmd"`
+	RunArgs        []string            `toml:"run_args" yaml:"run_args"`
+	Env            map[string]string   `toml:"env" yaml:"env"`
+	EnvFiles       []string            `toml:"env_files" yaml:"env_files"`
+	WorkingDir     string              `toml:"working_dir" yaml:"working_dir"`
+	Rules          []ruleSettings      `toml:"rules" yaml:"rules"`
+	Generators     []generatorSettings `toml:"generators" yaml:"generators"`
+	Targets        []targetSettings    `toml:"targets" yaml:"targets"`
+	DepGraph       *bool               `toml:"dep_graph" yaml:"dep_graph"`
+	NoTTY          *bool               `toml:"no_tty" yaml:"no_tty"`
+	Debug          *bool               `toml:"debug" yaml:"debug"`
+	DebugAddr      string              `toml:"debug_addr" yaml:"debug_addr"`
+	CacheSize      *int                `toml:"cache_size" yaml:"cache_size"`
+	Cover          string              `toml:"cover" yaml:"cover"`
+	CoverHTML      string              `toml:"cover_html" yaml:"cover_html"`
+	KeepRunning    *bool               `toml:"keep_running" yaml:"keep_running"`
+	Poll           time.Duration       `toml:"poll" yaml:"poll"`
+	PollHash       *bool               `toml:"poll_hash" yaml:"poll_hash"`
+
+	ReadyTCP     string        `toml:"ready_tcp" yaml:"ready_tcp"`
+	ReadyHTTP    string        `toml:"ready_http" yaml:"ready_http"`
+	ReadyStatus  int           `toml:"ready_status" yaml:"ready_status"`
+	ReadyLog     string        `toml:"ready_log" yaml:"ready_log"`
+	ReadyTimeout time.Duration `toml:"ready_timeout" yaml:"ready_timeout"`
+
+	Proxy       string `toml:"proxy" yaml:"proxy"`
+	ProxyTarget string `toml:"proxy_target" yaml:"proxy_target"`
+	LiveReload  *bool  `toml:"live_reload" yaml:"live_reload"`
+
+	Ctl string `toml:"ctl" yaml:"ctl"`
+
+	StopSignal  string        `toml:"stop_signal" yaml:"stop_signal"`
+	StopTimeout time.Duration `toml:"stop_timeout" yaml:"stop_timeout"`
+	ShutdownCmd string        `toml:"shutdown_cmd" yaml:"shutdown_cmd"`
+
+	Restart        string        `toml:"restart" yaml:"restart"`
+	RestartRetries *int          `toml:"restart_retries" yaml:"restart_retries"`
+	RestartBackoff time.Duration `toml:"restart_backoff" yaml:"restart_backoff"`
+}
+
+// ruleSettings is a rule in a config file
+type ruleSettings struct {
+	Pattern string `toml:"pattern" yaml:"pattern"`
+	Action  string `toml:"action" yaml:"action"`
+	Command string `toml:"command" yaml:"command"`
+}
+
+// generatorSettings is a code generator in a config file
+type generatorSettings struct {
+	Pattern string   `toml:"pattern" yaml:"pattern"`
+	Command string   `toml:"command" yaml:"command"`
+	Outputs []string `toml:"outputs" yaml:"outputs"`
+}
+
+// targetSettings is a named target in a config file
+type targetSettings struct {
+	Name        string            `toml:"name" yaml:"name"`
+	Package     string            `toml:"package" yaml:"package"`
+	BuildArgs   []string          `toml:"build_args" yaml:"build_args"`
+	RunArgs     []string          `toml:"run_args" yaml:"run_args"`
+	Env         map[string]string `toml:"env" yaml:"env"`
+	EnvFiles    []string          `toml:"env_files" yaml:"env_files"`
+	WorkingDir  string            `toml:"working_dir" yaml:"working_dir"`
+	StopSignal  string            `toml:"stop_signal" yaml:"stop_signal"`
+	StopTimeout time.Duration     `toml:"stop_timeout" yaml:"stop_timeout"`
+	ShutdownCmd string            `toml:"shutdown_cmd" yaml:"shutdown_cmd"`
+}
+
+// config is the content of a pulse config file
+type config struct {
+	settings `yaml:",inline"`
+	Profiles map[string]settings `toml:"profiles" yaml:"profiles"`
+}
+
+// loadConfig reads the config file at path. When path is empty, the config file
+// names are looked up in the current directory and a nil config is returned if
+// none of them exists.
+func loadConfig(path string) (*config, error) {
+	if path == "" {
+		for _, name := range configFileNames {
+			if _, err := os.Stat(name); err == nil {
+				path = name
+				break
+			}
+		}
+		if path == "" {
+			return nil, nil
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read config file: %w", err)
+	}
+
+	var cfg config
+	switch filepath.Ext(path) {
+	case ".toml":
+		err = toml.Unmarshal(data, &cfg)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &cfg)
+	default:
+		return nil, fmt.Errorf("unsupported config file format %s", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse config file %s: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+// resolve returns the top level settings with the named profile applied on top
+func (c *config) resolve(profile string) (settings, error) {
+	if profile == "" {
+		return c.settings, nil
+	}
+
+	p, ok := c.Profiles[profile]
+	if !ok {
+		return settings{}, fmt.Errorf("profile %q not found in config file", profile)
+	}
+	return c.settings.merge(p), nil
+}
+
+// merge returns s overridden by every value set in o. Env entries are merged by key.
+func (s settings) merge(o settings) settings {
+	if o.Package != "" {
+		s.Package = o.Package
+	}
+	if o.WatchDirs != nil {
+		s.WatchDirs = o.WatchDirs
+	}
+	if o.Excludes != nil {
+		s.Excludes = o.Excludes
+	}
+	if o.DefaultIgnores != nil {
+		s.DefaultIgnores = o.DefaultIgnores
+	}
+	if o.BuildArgs != nil {
+		s.BuildArgs = o.BuildArgs
+	}
+	if o.PrebuildCmd != "" {
+		s.PrebuildCmd = o.PrebuildCmd
+	}
+	if o.RunArgs != nil {
+		s.RunArgs = o.RunArgs
+	}
+	if o.Env != nil {
+		env := make(map[string]string, len(s.Env)+len(o.Env))
+		for k, v := range s.Env {
+			env[k] = v
+		}
+		for k, v := range o.Env {
+			env[k] = v
+		}
+		s.Env = env
+	}
+	if o.EnvFiles != nil {
+		s.EnvFiles = o.EnvFiles
+	}
+	if o.WorkingDir != "" {
+		s.WorkingDir = o.WorkingDir
+	}
+	if o.Rules != nil {
+		s.Rules = o.Rules
+	}
+	if o.Generators != nil {
+		s.Generators = o.Generators
+	}
+	if o.Targets != nil {
+		s.Targets = o.Targets
+	}
+	if o.DepGraph != nil {
+		s.DepGraph = o.DepGraph
+	}
+	if o.NoTTY != nil {
+		s.NoTTY = o.NoTTY
+	}
+	if o.Debug != nil {
+		s.Debug = o.Debug
+	}
+	if o.DebugAddr != "" {
+		s.DebugAddr = o.DebugAddr
+	}
+	if o.CacheSize != nil {
+		s.CacheSize = o.CacheSize
+	}
+	if o.Cover != "" {
+		s.Cover = o.Cover
+	}
+	if o.CoverHTML != "" {
+		s.CoverHTML = o.CoverHTML
+	}
+	if o.KeepRunning != nil {
+		s.KeepRunning = o.KeepRunning
+	}
+	if o.Poll != 0 {
+		s.Poll = o.Poll
+	}
+	if o.PollHash != nil {
+		s.PollHash = o.PollHash
+	}
+	if o.ReadyTCP != "" {
+		s.ReadyTCP = o.ReadyTCP
+	}
+	if o.ReadyHTTP != "" {
+		s.ReadyHTTP = o.ReadyHTTP
+	}
+	if o.ReadyStatus != 0 {
+		s.ReadyStatus = o.ReadyStatus
+	}
+	if o.ReadyLog != "" {
+		s.ReadyLog = o.ReadyLog
+	}
+	if o.ReadyTimeout != 0 {
+		s.ReadyTimeout = o.ReadyTimeout
+	}
+	if o.Proxy != "" {
+		s.Proxy = o.Proxy
+	}
+	if o.ProxyTarget != "" {
+		s.ProxyTarget = o.ProxyTarget
+	}
+	if o.LiveReload != nil {
+		s.LiveReload = o.LiveReload
+	}
+	if o.Ctl != "" {
+		s.Ctl = o.Ctl
+	}
+	if o.StopSignal != "" {
+		s.StopSignal = o.StopSignal
+	}
+	if o.StopTimeout != 0 {
+		s.StopTimeout = o.StopTimeout
+	}
+	if o.ShutdownCmd != "" {
+		s.ShutdownCmd = o.ShutdownCmd
+	}
+	if o.Restart != "" {
+		s.Restart = o.Restart
+	}
+	if o.RestartRetries != nil {
+		s.RestartRetries = o.RestartRetries
+	}
+	if o.RestartBackoff != 0 {
+		s.RestartBackoff = o.RestartBackoff
+	}
+	return s
+}
+
+// applyConfig loads the config file, if any, and fills in every option that was
+// not explicitly set with a flag. Exclude patterns and rules from the file come
+// before the ones given with -x and -rule so the flags keep the highest priority. It returns args with
+// the package path and run arguments from the config file filled in when they
+// were not given on the command line.
+func applyConfig(args []string) ([]string, error) {
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		return nil, err
+	}
+	if cfg == nil {
+		if profile != "" {
+			return nil, fmt.Errorf("profile %q requested but no config file found", profile)
+		}
+		return args, nil
+	}
+
+	s, err := cfg.resolve(profile)
+	if err != nil {
+		return nil, err
+	}
+
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	excludes = append(slices.Clone(s.Excludes), excludes...)
+	if !set["defaultIgnores"] && s.DefaultIgnores != nil {
+		useDefaultIgnores = *s.DefaultIgnores
+	}
+
+	fileRules := make([]rule, 0, len(s.Rules))
+	for _, r := range s.Rules {
+		action := r.Action
+		if action == "" && r.Command != "" {
+			action = "run"
+		}
+		parsed, err := newRule(r.Pattern, action, r.Command)
+		if err != nil {
+			return nil, err
+		}
+		fileRules = append(fileRules, parsed)
+	}
+	rules = append(fileRules, rules...)
+
+	fileGenerators := make([]generator, 0, len(s.Generators))
+	for _, g := range s.Generators {
+		parsed, err := newGenerator(g.Pattern, g.Command, g.Outputs)
+		if err != nil {
+			return nil, err
+		}
+		fileGenerators = append(fileGenerators, parsed)
+	}
+	generators = append(fileGenerators, generators...)
+	if !set["wd"] && s.WatchDirs != nil {
+		watchDirs = s.WatchDirs
+	}
+	if !set["buildArgs"] && s.BuildArgs != nil {
+		buildArgs = s.BuildArgs
+	}
+	if !set["pbc"] && s.PrebuildCmd != "" {
+		prebuildCmd = s.PrebuildCmd
+	}
+	if !set["cwd"] && s.WorkingDir != "" {
+		workingDir = s.WorkingDir
+	}
+	if !set["keepRunning"] && s.KeepRunning != nil {
+		keepRunning = *s.KeepRunning
+	}
+	if !set["poll"] && s.Poll != 0 {
+		pollInterval = s.Poll
+	}
+	if !set["pollHash"] && s.PollHash != nil {
+		pollHash = *s.PollHash
+	}
+	if !set["readyTCP"] && s.ReadyTCP != "" {
+		readyTCP = s.ReadyTCP
+	}
+	if !set["readyHTTP"] && s.ReadyHTTP != "" {
+		readyHTTP = s.ReadyHTTP
+	}
+	if !set["readyStatus"] && s.ReadyStatus != 0 {
+		readyStatus = s.ReadyStatus
+	}
+	if !set["readyLog"] && s.ReadyLog != "" {
+		readyLog = s.ReadyLog
+	}
+	if !set["readyTimeout"] && s.ReadyTimeout != 0 {
+		readyTimeout = s.ReadyTimeout
+	}
+	if !set["proxy"] && s.Proxy != "" {
+		proxyAddr = s.Proxy
+	}
+	if !set["proxyTarget"] && s.ProxyTarget != "" {
+		proxyTarget = s.ProxyTarget
+	}
+	if !set["liveReload"] && s.LiveReload != nil {
+		liveReload = *s.LiveReload
+	}
+	if !set["ctl"] && s.Ctl != "" {
+		ctlAddr = s.Ctl
+	}
+	if !set["stopSignal"] && s.StopSignal != "" {
+		stopSignal = s.StopSignal
+	}
+	if !set["stopTimeout"] && s.StopTimeout != 0 {
+		stopTimeout = s.StopTimeout
+	}
+	if !set["shutdownCmd"] && s.ShutdownCmd != "" {
+		shutdownCmd = s.ShutdownCmd
+	}
+	if !set["restart"] && s.Restart != "" {
+		restartMode = s.Restart
+	}
+	if !set["restartRetries"] && s.RestartRetries != nil {
+		restartMax = *s.RestartRetries
+	}
+	if !set["restartBackoff"] && s.RestartBackoff != 0 {
+		restartDelay = s.RestartBackoff
+	}
+
+	if !set["noTTY"] && s.NoTTY != nil {
+		noTTY = *s.NoTTY
+	}
+	if !set["debug"] && s.Debug != nil {
+		debugMode = *s.Debug
+	}
+	if !set["debugAddr"] && s.DebugAddr != "" {
+		debugAddr = s.DebugAddr
+	}
+	if !set["cacheSize"] && s.CacheSize != nil {
+		cacheSize = *s.CacheSize
+	}
+	if !set["cover"] && s.Cover != "" {
+		coverDir = s.Cover
+	}
+	if !set["coverHTML"] && s.CoverHTML != "" {
+		coverHTML = s.CoverHTML
+	}
+	if !set["depGraph"] && s.DepGraph != nil {
+		depGraph = *s.DepGraph
+	}
+	if !set["target"] && s.Targets != nil {
+		targets = nil
+		for _, t := range s.Targets {
+			if t.Name == "" || t.Package == "" {
+				return nil, fmt.Errorf("targets in the config file need a name and a package")
+			}
+			targets = append(targets, targetSpec{
+				name:        t.Name,
+				packagePath: t.Package,
+				buildArgs:   t.BuildArgs,
+				runArgs:     t.RunArgs,
+				env:         sortedEnv(t.Env),
+				envFiles:    t.EnvFiles,
+				workingDir:  t.WorkingDir,
+				stopSignal:  t.StopSignal,
+				stopTimeout: t.StopTimeout,
+				shutdownCmd: t.ShutdownCmd,
+			})
+		}
+	}
+
+	if !set["envFile"] && s.EnvFiles != nil {
+		envFiles = s.EnvFiles
+	}
+
+	// Variables from -env flags come last so they win over the config file
+	envVars = append(sortedEnv(s.Env), envVars...)
+
+	if len(targets) > 0 {
+		// Package and run arguments are set per target
+		return args, nil
+	}
+	if (len(args) == 0 || args[0] == "--") && s.Package != "" {
+		args = append([]string{s.Package}, args...)
+	}
+	if !slices.Contains(args, "--") && len(s.RunArgs) > 0 {
+		if len(args) == 0 {
+			args = []string{"."}
+		}
+		args = append(append(args, "--"), s.RunArgs...)
+	}
+	return args, nil
+}
+
+// sortedEnv returns env as KEY=VALUE pairs sorted by key
+func sortedEnv(env map[string]string) []string {
+	pairs := make([]string, 0, len(env))
+	for k, v := range env {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return pairs
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+const testConfig = `package = "./cmd/app"
+run_args = ["-v"]
+prebuild_cmd = "make top"
+working_dir = "srv"
+excludes = ["file.log"]
+keep_running = true
+env = { A = "top", B = "top" }
+
+[[rules]]
+pattern = "*.sql"
+action = "restart"
+
+[profiles.dev]
+prebuild_cmd = "make dev"
+env = { B = "dev" }
+`
+
+// parseTestFlags resets the options applyConfig reads and writes and parses
+// args with a fresh flag set, the way main does
+func parseTestFlags(t *testing.T, args []string) []string {
+	t.Helper()
+
+	commandLine := flag.CommandLine
+	t.Cleanup(func() { flag.CommandLine = commandLine })
+	flag.CommandLine = flag.NewFlagSet("pulse", flag.ContinueOnError)
+
+	excludes, rules, generators, targets, envVars, envFiles = nil, nil, nil, nil, nil, nil
+	useDefaultIgnores = true
+	flag.Var(&excludes, "x", "")
+	flag.Var(&rules, "rule", "")
+	flag.Var(&envVars, "env", "")
+	flag.BoolVar(&useDefaultIgnores, "defaultIgnores", true, "")
+	flag.StringVar(&workingDir, "cwd", ".", "")
+	flag.StringVar(&prebuildCmd, "pbc", "", "")
+	flag.BoolVar(&keepRunning, "keepRunning", false, "")
+	flag.StringVar(&configPath, "config", "", "")
+	flag.StringVar(&profile, "profile", "", "")
+	flagArgs, passThrough := splitArgs(args)
+	if err := flag.CommandLine.Parse(flagArgs); err != nil {
+		t.Fatalf("Parse(%q) error = %v", args, err)
+	}
+	return append(flag.Args(), passThrough...)
+}
+
+func writeTestConfig(t *testing.T, name, content string) {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(dir)
+}
+
+func TestApplyConfig(t *testing.T) {
+	tests := []struct {
+		name            string
+		args            []string
+		wantArgs        []string
+		wantPrebuildCmd string
+		wantWorkingDir  string
+		wantKeepRunning bool
+		wantExcludes    []string
+		wantRules       []string
+		wantEnv         []string
+	}{
+		{
+			name:            "FileValues",
+			wantArgs:        []string{"./cmd/app", "--", "-v"},
+			wantPrebuildCmd: "make top",
+			wantWorkingDir:  "srv",
+			wantKeepRunning: true,
+			wantExcludes:    []string{"file.log"},
+			wantRules:       []string{"*.sql=restart"},
+			wantEnv:         []string{"A=top", "B=top"},
+		},
+		{
+			name:            "ProfileOverTopLevel",
+			args:            []string{"-profile", "dev"},
+			wantArgs:        []string{"./cmd/app", "--", "-v"},
+			wantPrebuildCmd: "make dev",
+			wantWorkingDir:  "srv",
+			wantKeepRunning: true,
+			wantExcludes:    []string{"file.log"},
+			wantRules:       []string{"*.sql=restart"},
+			wantEnv:         []string{"A=top", "B=dev"},
+		},
+		{
+			name:            "FlagsOverFile",
+			args:            []string{"-pbc", "make flag", "-cwd", "other", "-keepRunning=false"},
+			wantArgs:        []string{"./cmd/app", "--", "-v"},
+			wantPrebuildCmd: "make flag",
+			wantWorkingDir:  "other",
+			wantKeepRunning: false,
+			wantExcludes:    []string{"file.log"},
+			wantRules:       []string{"*.sql=restart"},
+			wantEnv:         []string{"A=top", "B=top"},
+		},
+		{
+			name:            "FlagEntriesAfterFile",
+			args:            []string{"-x", "*.tmp", "-rule", "*.sql=rebuild", "-env", "B=flag"},
+			wantArgs:        []string{"./cmd/app", "--", "-v"},
+			wantPrebuildCmd: "make top",
+			wantWorkingDir:  "srv",
+			wantKeepRunning: true,
+			wantExcludes:    []string{"file.log", "*.tmp"},
+			wantRules:       []string{"*.sql=restart", "*.sql=rebuild"},
+			wantEnv:         []string{"A=top", "B=top", "B=flag"},
+		},
+		{
+			name:            "PackageGiven",
+			args:            []string{"./other"},
+			wantArgs:        []string{"./other", "--", "-v"},
+			wantPrebuildCmd: "make top",
+			wantWorkingDir:  "srv",
+			wantKeepRunning: true,
+			wantExcludes:    []string{"file.log"},
+			wantRules:       []string{"*.sql=restart"},
+			wantEnv:         []string{"A=top", "B=top"},
+		},
+		{
+			name:            "OnlyRunArgsGiven",
+			args:            []string{"--", "-x"},
+			wantArgs:        []string{"./cmd/app", "--", "-x"},
+			wantPrebuildCmd: "make top",
+			wantWorkingDir:  "srv",
+			wantKeepRunning: true,
+			wantExcludes:    []string{"file.log"},
+			wantRules:       []string{"*.sql=restart"},
+			wantEnv:         []string{"A=top", "B=top"},
+		},
+		{
+			name:            "RunArgsGiven",
+			args:            []string{"./other", "--", "-x"},
+			wantArgs:        []string{"./other", "--", "-x"},
+			wantPrebuildCmd: "make top",
+			wantWorkingDir:  "srv",
+			wantKeepRunning: true,
+			wantExcludes:    []string{"file.log"},
+			wantRules:       []string{"*.sql=restart"},
+			wantEnv:         []string{"A=top", "B=top"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writeTestConfig(t, "pulse.toml", testConfig)
+
+			args, err := applyConfig(parseTestFlags(t, tt.args))
+			if err != nil {
+				t.Fatalf("applyConfig() error = %v", err)
+			}
+
+			if !slices.Equal(args, tt.wantArgs) {
+				t.Errorf("args = %q, want %q", args, tt.wantArgs)
+			}
+			if prebuildCmd != tt.wantPrebuildCmd {
+				t.Errorf("prebuildCmd = %q, want %q", prebuildCmd, tt.wantPrebuildCmd)
+			}
+			if workingDir != tt.wantWorkingDir {
+				t.Errorf("workingDir = %q, want %q", workingDir, tt.wantWorkingDir)
+			}
+			if keepRunning != tt.wantKeepRunning {
+				t.Errorf("keepRunning = %v, want %v", keepRunning, tt.wantKeepRunning)
+			}
+			if !slices.Equal(excludes, tt.wantExcludes) {
+				t.Errorf("excludes = %q, want %q", excludes, tt.wantExcludes)
+			}
+			var gotRules []string
+			for _, r := range rules {
+				gotRules = append(gotRules, r.pattern+"="+r.action.String())
+			}
+			if !slices.Equal(gotRules, tt.wantRules) {
+				t.Errorf("rules = %q, want %q", gotRules, tt.wantRules)
+			}
+			if !slices.Equal(envVars, tt.wantEnv) {
+				t.Errorf("envVars = %q, want %q", envVars, tt.wantEnv)
+			}
+		})
+	}
+}
+
+func TestApplyConfig_NoConfig(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	args, err := applyConfig(parseTestFlags(t, []string{"-pbc", "make", "."}))
+	if err != nil {
+		t.Fatalf("applyConfig() error = %v", err)
+	}
+	if !slices.Equal(args, []string{"."}) || prebuildCmd != "make" || workingDir != "." {
+		t.Errorf("applyConfig() changed the flags without a config file: args = %q, pbc = %q, cwd = %q", args, prebuildCmd, workingDir)
+	}
+
+	if _, err := applyConfig(parseTestFlags(t, []string{"-profile", "dev"})); err == nil {
+		t.Error("applyConfig() with a profile and no config file succeeded")
+	}
+}
+
+func TestApplyConfig_UnknownProfile(t *testing.T) {
+	writeTestConfig(t, "pulse.toml", testConfig)
+
+	if _, err := applyConfig(parseTestFlags(t, []string{"-profile", "prod"})); err == nil {
+		t.Error("applyConfig() with an unknown profile succeeded")
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	writeTestConfig(t, "pulse.yaml", `package: ./cmd/app
+keep_running: false
+profiles:
+  dev:
+    keep_running: true
+    excludes: ["*.tmp"]
+`)
+
+	cfg, err := loadConfig("")
+	if err != nil {
+		t.Fatalf("loadConfig() error = %v", err)
+	}
+	s, err := cfg.resolve("dev")
+	if err != nil {
+		t.Fatalf("resolve() error = %v", err)
+	}
+	if s.Package != "./cmd/app" {
+		t.Errorf("Package = %q, want ./cmd/app", s.Package)
+	}
+	if s.KeepRunning == nil || !*s.KeepRunning {
+		t.Errorf("KeepRunning = %v, want true from the profile", s.KeepRunning)
+	}
+	if !slices.Equal(s.Excludes, []string{"*.tmp"}) {
+		t.Errorf("Excludes = %q, want [*.tmp]", s.Excludes)
+	}
+
+	if _, err := loadConfig("pulse.json"); err == nil {
+		t.Error("loadConfig() of an unsupported format succeeded")
+	}
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/panotza/pulse/work"
+)
+
+// controlAction is a request to the session made through the control API
+type controlAction string
+
+const (
+	controlRebuild controlAction = "rebuild"
+	controlRestart controlAction = "restart"
+	controlPause   controlAction = "pause"
+	controlResume  controlAction = "resume"
+)
+
+// sessionStatus is the response of the status endpoint
+type sessionStatus struct {
+	Paused  bool           `json:"paused"`
+	Targets []targetStatus `json:"targets"`
+}
+
+// targetStatus is the state of a target as told by its events
+type targetStatus struct {
+	Name string `json:"name,omitempty"`
+	// State is building, running, failed or stopped
+	State     string       `json:"state"`
+	PID       int          `json:"pid,omitempty"`
+	StartedAt *time.Time   `json:"started_at,omitempty"`
+	UptimeMS  int64        `json:"uptime_ms,omitempty"`
+	LastBuild *buildStatus `json:"last_build,omitempty"`
+
+	building bool
+}
+
+// buildStatus is the outcome of the last build of a target
+type buildStatus struct {
+	Success    bool      `json:"success"`
+	Time       time.Time `json:"time"`
+	DurationMS int64     `json:"duration_ms"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// controlServer serves the control API. It follows the session through its
+// events and passes requested actions to the main loop.
+type controlServer struct {
+	actions chan controlAction
+
+	mu          sync.Mutex
+	paused      bool
+	targets     []*targetStatus
+	subscribers map[chan work.Event]struct{}
+}
+
+func newControlServer(names []string) *controlServer {
+	s := &controlServer{
+		actions:     make(chan controlAction),
+		subscribers: make(map[chan work.Event]struct{}),
+	}
+	for _, name := range names {
+		s.targets = append(s.targets, &targetStatus{Name: name, State: "stopped"})
+	}
+	return s
+}
+
+// handle updates the status with the event and passes it to every event stream
+func (s *controlServer) handle(e work.Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, t := range s.targets {
+		if t.Name == e.Target {
+			t.update(e)
+		}
+	}
+	for events := range s.subscribers {
+		select {
+		case events <- e:
+		default:
+			// A stream that doesn't keep up misses events rather than blocking the session
+		}
+	}
+}
+
+func (t *targetStatus) update(e work.Event) {
+	switch e.Type {
+	case work.EventBuildStart:
+		t.building = true
+	case work.EventBuildSuccess, work.EventBuildFailure:
+		t.building = false
+		t.LastBuild = &buildStatus{
+			Success:    e.Type == work.EventBuildSuccess,
+			Time:       e.Time,
+			DurationMS: e.DurationMS,
+			Error:      e.Error,
+		}
+	case work.EventProcessStart:
+		startedAt := e.Time
+		t.PID, t.StartedAt = e.PID, &startedAt
+	case work.EventProcessExit:
+		t.PID, t.StartedAt = 0, nil
+	}
+}
+
+// setPaused records whether the watcher is paused
+func (s *controlServer) setPaused(paused bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.paused = paused
+}
+
+// status returns a snapshot of the session
+func (s *controlServer) status() sessionStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status := sessionStatus{Paused: s.paused, Targets: make([]targetStatus, 0, len(s.targets))}
+	for _, t := range s.targets {
+		ts := *t
+		switch {
+		case t.building:
+			ts.State = "building"
+		case t.PID != 0:
+			ts.State = "running"
+			ts.UptimeMS = time.Since(*t.StartedAt).Milliseconds()
+		case t.LastBuild != nil && !t.LastBuild.Success:
+			ts.State = "failed"
+		default:
+			ts.State = "stopped"
+		}
+		status.Targets = append(status.Targets, ts)
+	}
+	return status
+}
+
+func (s *controlServer) subscribe() chan work.Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	events := make(chan work.Event, 64)
+	s.subscribers[events] = struct{}{}
+	return events
+}
+
+func (s *controlServer) unsubscribe(events chan work.Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.subscribers, events)
+}
+
+func (s *controlServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch path := strings.TrimPrefix(r.URL.Path, "/"); path {
+	case "status":
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(s.status())
+	case "events":
+		s.serveEvents(w, r)
+	case string(controlRebuild), string(controlRestart), string(controlPause), string(controlResume):
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		select {
+		case s.actions <- controlAction(path):
+			w.WriteHeader(http.StatusAccepted)
+		case <-r.Context().Done():
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// serveEvents streams events as newline-delimited JSON until the client leaves
+func (s *controlServer) serveEvents(w http.ResponseWriter, r *http.Request) {
+	events := s.subscribe()
+	defer s.unsubscribe(events)
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	rc := http.NewResponseController(w)
+	_ = rc.Flush()
+
+	enc := json.NewEncoder(w)
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e := <-events:
+			if err := enc.Encode(e); err != nil {
+				return
+			}
+			_ = rc.Flush()
+		}
+	}
+}
+
+// Serve serves the API on l until ctx is done
+func (s *controlServer) Serve(ctx context.Context, l net.Listener) error {
+	srv := &http.Server{
+		Handler: s,
+		BaseContext: func(net.Listener) context.Context {
+			return ctx
+		},
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
+	err := srv.Serve(l)
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// isTCPAddr reports whether a control address is host:port rather than a
+// Unix socket path
+func isTCPAddr(addr string) bool {
+	_, _, err := net.SplitHostPort(addr)
+	return err == nil && !strings.ContainsAny(addr, `/\`)
+}
+
+// checkLoopback returns an error unless the host of a TCP control address only
+// resolves to loopback addresses. The API is unauthenticated, it must not be
+// reachable from other machines.
+func checkLoopback(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if host == "" {
+		return fmt.Errorf("control address %s listens on every interface, use localhost:PORT or a Unix socket", addr)
+	}
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		return fmt.Errorf("resolve control address: %w", err)
+	}
+	for _, ip := range ips {
+		if !ip.IsLoopback() {
+			return fmt.Errorf("control address %s is not a loopback address, use localhost:PORT or a Unix socket", addr)
+		}
+	}
+	return nil
+}
+
+// listenControl listens on a loopback TCP address or a Unix socket. A socket
+// left behind by a session that didn't shut down cleanly is replaced.
+func listenControl(addr string) (net.Listener, error) {
+	if isTCPAddr(addr) {
+		if err := checkLoopback(addr); err != nil {
+			return nil, err
+		}
+		return net.Listen("tcp", addr)
+	}
+
+	if _, err := os.Stat(addr); err == nil {
+		if conn, err := net.Dial("unix", addr); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("control socket %s is in use by another session", addr)
+		}
+		if err := os.Remove(addr); err != nil {
+			return nil, fmt.Errorf("remove stale control socket: %w", err)
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	// The listener removes the socket file when it is closed
+	return net.Listen("unix", addr)
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/panotza/pulse/work"
+)
+
+func TestListenControl(t *testing.T) {
+	tests := []struct {
+		addr    string
+		wantErr bool
+	}{
+		{"127.0.0.1:0", false},
+		{"localhost:0", false},
+		{filepath.Join(t.TempDir(), "pulse.sock"), false},
+		{":0", true},
+		{"0.0.0.0:0", true},
+		{"[::]:0", true},
+		{"192.0.2.1:0", true},
+	}
+
+	for _, tt := range tests {
+		l, err := listenControl(tt.addr)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("listenControl(%q) error = %v, wantErr %v", tt.addr, err, tt.wantErr)
+		}
+		if l != nil {
+			l.Close()
+		}
+	}
+}
+
+func TestControlServer_Status(t *testing.T) {
+	s := newControlServer([]string{"api", "worker"})
+	at := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	s.handle(work.Event{Type: work.EventBuildStart, Target: "api", Time: at})
+	s.handle(work.Event{Type: work.EventBuildSuccess, Target: "api", Time: at, DurationMS: 120})
+	s.handle(work.Event{Type: work.EventProcessStart, Target: "api", Time: at, PID: 42})
+	s.handle(work.Event{Type: work.EventBuildStart, Target: "worker", Time: at})
+	s.handle(work.Event{Type: work.EventBuildFailure, Target: "worker", Time: at, DurationMS: 80, Error: "build failed"})
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("GET /status = %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+
+	var status map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+		t.Fatal(err)
+	}
+	targets := status["targets"].([]any)
+	api, worker := targets[0].(map[string]any), targets[1].(map[string]any)
+	if status["paused"] != false || len(targets) != 2 {
+		t.Errorf("status = %v", status)
+	}
+	if api["name"] != "api" || api["state"] != "running" || api["pid"] != 42.0 || api["started_at"] != "2026-01-02T03:04:05Z" || api["uptime_ms"] == nil {
+		t.Errorf("api = %v, want running with pid 42", api)
+	}
+	if build := api["last_build"].(map[string]any); build["success"] != true || build["duration_ms"] != 120.0 || build["time"] != "2026-01-02T03:04:05Z" || build["error"] != nil {
+		t.Errorf("api last_build = %v", build)
+	}
+	if _, ok := worker["pid"]; ok || worker["state"] != "failed" {
+		t.Errorf("worker = %v, want failed without a pid", worker)
+	}
+	if build := worker["last_build"].(map[string]any); build["success"] != false || build["error"] != "build failed" {
+		t.Errorf("worker last_build = %v", build)
+	}
+}
+
+func TestControlServer_Actions(t *testing.T) {
+	s := newControlServer([]string{""})
+
+	// Actions only accept POST
+	for _, action := range []controlAction{controlRebuild, controlRestart, controlPause, controlResume} {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/"+string(action), nil))
+		if rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("Allow") != http.MethodPost {
+			t.Errorf("GET /%s = %d, Allow %q, want 405 with Allow POST", action, rec.Code, rec.Header().Get("Allow"))
+		}
+	}
+
+	// The main loop receives the action and reports the new state back
+	go func() {
+		for action := range s.actions {
+			s.setPaused(action == controlPause)
+		}
+	}()
+	defer close(s.actions)
+
+	for _, tt := range []struct {
+		action controlAction
+		paused bool
+	}{
+		{controlPause, true},
+		{controlResume, false},
+		{controlPause, true},
+	} {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/"+string(tt.action), nil))
+		if rec.Code != http.StatusAccepted {
+			t.Fatalf("POST /%s = %d, want 202", tt.action, rec.Code)
+		}
+		deadline := time.Now().Add(time.Second)
+		for s.status().Paused != tt.paused && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		if s.status().Paused != tt.paused {
+			t.Errorf("paused after /%s = %v, want %v", tt.action, !tt.paused, tt.paused)
+		}
+	}
+}
+
+func TestControlServer_Events(t *testing.T) {
+	s := newControlServer([]string{""})
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/events", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	s.handle(work.Event{Type: work.EventReady, DurationMS: 30})
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	var e work.Event
+	if err := json.Unmarshal([]byte(line), &e); err != nil || e.Type != work.EventReady || e.DurationMS != 30 {
+		t.Errorf("event = %q, %v, want ready", line, err)
+	}
+
+	// A client going away is unsubscribed
+	cancel()
+	subscribers := func() int {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return len(s.subscribers)
+	}
+	deadline := time.Now().Add(time.Second)
+	for subscribers() > 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if n := subscribers(); n != 0 {
+		t.Errorf("%d subscribers left after the client disconnected", n)
+	}
+}
+
+func TestRunCtl_Status(t *testing.T) {
+	s := newControlServer([]string{"api"})
+	addr := filepath.Join(t.TempDir(), "pulse.sock")
+	l, err := listenControl(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Serve(ctx, l)
+
+	oldAddr, stdout := ctlAddr, os.Stdout
+	t.Cleanup(func() { ctlAddr, os.Stdout = oldAddr, stdout })
+	ctlAddr = addr
+	os.Stdout, err = os.Create(filepath.Join(t.TempDir(), "stdout"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Stdout.Close()
+
+	s.handle(work.Event{Type: work.EventBuildSuccess, Target: "api"})
+	if err := runCtl([]string{"status"}); err != nil {
+		t.Errorf("runCtl(status) after a successful build error = %v", err)
+	}
+
+	// Hooks checking the session get a non-zero exit after a failed build
+	s.handle(work.Event{Type: work.EventBuildFailure, Target: "api", Error: "build failed"})
+	if err := runCtl([]string{"status"}); err == nil || !strings.Contains(err.Error(), "build failed") {
+		t.Errorf("runCtl(status) after a failed build error = %v, want last build failed", err)
+	}
+}
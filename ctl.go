@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+)
+
+// runCtl calls the control API of a running session. The command in args is
+// status, events, rebuild, restart, pause or resume.
+func runCtl(args []string) error {
+	if ctlAddr == "" {
+		return errors.New("no control address, set -ctl or ctl in the config file")
+	}
+	if len(args) != 1 {
+		return errors.New("usage: pulse ctl [-ctl ADDR] status|events|rebuild|restart|pause|resume")
+	}
+
+	ctx, shutdown := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer shutdown()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			if isTCPAddr(ctlAddr) {
+				return d.DialContext(ctx, "tcp", ctlAddr)
+			}
+			return d.DialContext(ctx, "unix", ctlAddr)
+		},
+	}}
+
+	command := args[0]
+	method := http.MethodPost
+	switch command {
+	case "status", "events":
+		method = http.MethodGet
+	case string(controlRebuild), string(controlRestart), string(controlPause), string(controlResume):
+	default:
+		return fmt.Errorf("unknown command %q", command)
+	}
+
+	// The host is ignored, connections always go to the control address
+	req, err := http.NewRequestWithContext(ctx, method, "http://pulse/"+command, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("call control API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	switch command {
+	case "status":
+		var status sessionStatus
+		if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+			return fmt.Errorf("decode status: %w", err)
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(status); err != nil {
+			return err
+		}
+		// Exit with an error when a build failed, for hooks checking the session
+		for _, t := range status.Targets {
+			if t.LastBuild != nil && !t.LastBuild.Success {
+				return errors.New("last build failed")
+			}
+		}
+	case "events":
+		if _, err := io.Copy(os.Stdout, resp.Body); err != nil && ctx.Err() == nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+
+	"github.com/panotza/pulse/work"
+)
+
+// jsonEvents writes lifecycle events as newline-delimited JSON
+type jsonEvents struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	c   io.Closer
+}
+
+// openJSONEvents opens the JSON event stream at path, "-" or an empty path
+// meaning stdout
+func openJSONEvents(path string) (*jsonEvents, error) {
+	if path == "" || path == "-" {
+		return &jsonEvents{enc: json.NewEncoder(os.Stdout)}, nil
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open json event output: %w", err)
+	}
+	return &jsonEvents{enc: json.NewEncoder(f), c: f}, nil
+}
+
+func (e *jsonEvents) handle(event work.Event) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if err := e.enc.Encode(event); err != nil {
+		log.Printf("[Pulse] failed to write json event: %v\n", err)
+	}
+}
+
+func (e *jsonEvents) Close() error {
+	if e.c == nil {
+		return nil
+	}
+	return e.c.Close()
+}
+
+// combineEvents returns a handler passing events to every non-nil handler
+func combineEvents(handlers ...work.EventHandler) work.EventHandler {
+	var combined []work.EventHandler
+	for _, h := range handlers {
+		if h != nil {
+			combined = append(combined, h)
+		}
+	}
+	switch len(combined) {
+	case 0:
+		return nil
+	case 1:
+		return combined[0]
+	}
+	return func(e work.Event) {
+		for _, h := range combined {
+			h(e)
+		}
+	}
+}
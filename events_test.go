@@ -0,0 +1,62 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/panotza/pulse/work"
+)
+
+func TestJSONEvents(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.ndjson")
+	events, err := openJSONEvents(path)
+	if err != nil {
+		t.Fatalf("openJSONEvents() error = %v", err)
+	}
+
+	at := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	exitCode := 0
+	events.handle(work.Event{
+		Type:       work.EventBuildFailure,
+		Time:       at,
+		Package:    "./cmd/app",
+		DurationMS: 120,
+		Error:      "build failed",
+		Diagnostics: []work.Diagnostic{
+			{File: "/src/main.go", Line: 3, Column: 5, Message: "undefined: x"},
+			{Package: "example.com/m/lib", File: "/src/lib/lib.go", Line: 7, Message: "missing return"},
+		},
+	})
+	events.handle(work.Event{Type: work.EventProcessExit, Time: at, Target: "api", ExitCode: &exitCode})
+	if err := events.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Empty fields are left out, except an exit code of 0
+	want := `{"type":"build_failure","time":"2026-01-02T03:04:05Z","package":"./cmd/app","duration_ms":120,"error":"build failed","diagnostics":[{"file":"/src/main.go","line":3,"column":5,"message":"undefined: x"},{"package":"example.com/m/lib","file":"/src/lib/lib.go","line":7,"message":"missing return"}]}
+{"type":"process_exit","time":"2026-01-02T03:04:05Z","target":"api","exit_code":0}
+`
+	if string(got) != want {
+		t.Errorf("events =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestCombineEvents(t *testing.T) {
+	if h := combineEvents(nil, nil); h != nil {
+		t.Error("combineEvents() of nil handlers is not nil")
+	}
+
+	var a, b []work.EventType
+	h := combineEvents(nil, func(e work.Event) { a = append(a, e.Type) }, nil, func(e work.Event) { b = append(b, e.Type) })
+	h.Emit(work.Event{Type: work.EventReady})
+
+	if len(a) != 1 || len(b) != 1 || a[0] != work.EventReady || b[0] != work.EventReady {
+		t.Errorf("handlers received %v and %v, want one ready event each", a, b)
+	}
+}
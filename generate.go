@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/codeglyph/go-dotignore"
+)
+
+// generator runs a code generation command when files matching its pattern
+// change. Its outputs are excluded from watching so generated files don't
+// trigger another cycle, which is why they are required.
+type generator struct {
+	pattern string
+	command string
+	outputs []string
+	matcher *dotignore.PatternMatcher
+}
+
+func newGenerator(pattern, command string, outputs []string) (generator, error) {
+	if pattern == "" || command == "" {
+		return generator{}, fmt.Errorf("generator %q needs a pattern and a command", pattern)
+	}
+	if len(outputs) == 0 || slices.Contains(outputs, "") {
+		return generator{}, fmt.Errorf("generator %s needs the patterns of its outputs, or the generated files trigger another cycle", pattern)
+	}
+
+	matcher, err := dotignore.NewPatternMatcher([]string{pattern})
+	if err != nil {
+		return generator{}, fmt.Errorf("generator %s: %w", pattern, err)
+	}
+	return generator{pattern: pattern, command: command, outputs: outputs, matcher: matcher}, nil
+}
+
+// parseGenerator parses PATTERN:OUTPUT[,...]=COMMAND, e.g.
+// "*.proto:gen/=buf generate"
+func parseGenerator(s string) (generator, error) {
+	spec, command, ok := strings.Cut(s, "=")
+	if !ok {
+		return generator{}, fmt.Errorf("expected PATTERN:OUTPUT[,...]=COMMAND, got %q", s)
+	}
+
+	pattern, outputs, ok := strings.Cut(spec, ":")
+	if !ok {
+		return generator{}, fmt.Errorf("expected PATTERN:OUTPUT[,...]=COMMAND, got %q", s)
+	}
+	return newGenerator(pattern, command, strings.Split(outputs, ","))
+}
+
+func (g generator) matches(path string) bool {
+	ok, err := g.matcher.Matches(path)
+	return err == nil && ok
+}
+
+// generatorOutputs returns the output patterns of all generators
+func generatorOutputs(generators []generator) []string {
+	var outputs []string
+	for _, g := range generators {
+		outputs = append(outputs, g.outputs...)
+	}
+	return outputs
+}
+
+type generatorFlag []generator
+
+func (f *generatorFlag) String() string { return "" }
+
+func (f *generatorFlag) Set(v string) error {
+	g, err := parseGenerator(v)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, g)
+	return nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseGenerator(t *testing.T) {
+	tests := []struct {
+		in          string
+		wantPattern string
+		wantOutputs []string
+		wantCommand string
+		wantErr     bool
+	}{
+		{in: "*.proto:gen/=buf generate", wantPattern: "*.proto", wantOutputs: []string{"gen/"}, wantCommand: "buf generate"},
+		{in: "query/*.sql:internal/db/,docs/db.md=sqlc generate", wantPattern: "query/*.sql", wantOutputs: []string{"internal/db/", "docs/db.md"}, wantCommand: "sqlc generate"},
+		{in: "*.templ:*_templ.go=templ generate -path=.", wantPattern: "*.templ", wantOutputs: []string{"*_templ.go"}, wantCommand: "templ generate -path=."},
+		{in: "*.proto=buf generate", wantErr: true},
+		{in: "*.proto:=buf generate", wantErr: true},
+		{in: "*.proto:gen/,=buf generate", wantErr: true},
+		{in: "*.proto:gen/", wantErr: true},
+		{in: "*.proto:gen/=", wantErr: true},
+		{in: ":gen/=buf generate", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		g, err := parseGenerator(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseGenerator(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if g.pattern != tt.wantPattern || g.command != tt.wantCommand || !slices.Equal(g.outputs, tt.wantOutputs) {
+			t.Errorf("parseGenerator(%q) = %s %q %q, want %s %q %q", tt.in, g.pattern, g.outputs, g.command, tt.wantPattern, tt.wantOutputs, tt.wantCommand)
+		}
+	}
+}
+
+func TestPlanner_PlanGenerators(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	var generators []generator
+	for _, s := range []string{"*.proto:gen/=buf generate", "query/*.sql:internal/db/=sqlc generate"} {
+		g, err := parseGenerator(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		generators = append(generators, g)
+	}
+	pl := planner{rules: mustRules(t, "*.proto=ignore"), generators: generators}
+
+	tests := []struct {
+		name         string
+		paths        []string
+		wantCommands []string
+	}{
+		{"NoMatch", []string{"handler.go"}, nil},
+		{"Match", []string{"api.proto"}, []string{"buf generate"}},
+		{"OncePerChangeSet", []string{"query/a.sql", "query/b.sql"}, []string{"sqlc generate"}},
+		{"Both", []string{"query/a.sql", "api.proto"}, []string{"sqlc generate", "buf generate"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := pl.plan(changeSetOf(tt.paths...))
+			// A generator rebuilds even when a rule ignores its files
+			if p.action != actionRebuild {
+				t.Errorf("action = %s, want rebuild", p.action)
+			}
+			if !slices.Equal(p.commands, tt.wantCommands) {
+				t.Errorf("commands = %q, want %q", p.commands, tt.wantCommands)
+			}
+		})
+	}
+}
@@ -5,8 +5,10 @@ go 1.24.0
 toolchain go1.24.4
 
 require (
+	github.com/BurntSushi/toml v1.6.0
 	github.com/codeglyph/go-dotignore v1.1.1
 	github.com/fsnotify/fsnotify v1.9.0
+	golang.org/x/sys v0.33.0
+	golang.org/x/term v0.32.0
+	gopkg.in/yaml.v3 v3.0.1
 )
-
-require golang.org/x/sys v0.33.0 // indirect
@@ -9,6 +9,32 @@ import (
 	"os"
 )
 
+// defaultIgnorePatterns covers files that editors, the OS and version control
+// write next to the sources and no build depends on. Patterns from .gitignore,
+// .pulseignore or -x can re-include any of them with a negation.
+var defaultIgnorePatterns = []string{
+	// Version control
+	".git", ".hg", ".svn", ".bzr", ".jj",
+	// Vim swap, backup and write probe files
+	"*.sw?", "*~", "4913",
+	// Emacs auto-save and lock files, a leading # would start a comment
+	"[#]*#", ".#*",
+	// JetBrains safe write
+	"*___jb_tmp___", "*___jb_old___",
+	// Temp files of atomic saves
+	"*.tmp",
+	// OS metadata
+	".DS_Store", "._*", "Thumbs.db", "desktop.ini", ".directory",
+}
+
+// defaultIgnores returns the default ignore patterns unless they are disabled
+func defaultIgnores() []string {
+	if !useDefaultIgnores {
+		return nil
+	}
+	return defaultIgnorePatterns
+}
+
 func readGitIgnore() []string {
 	f, err := os.Open(".gitignore")
 	if err != nil {
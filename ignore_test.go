@@ -0,0 +1,63 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/codeglyph/go-dotignore"
+)
+
+func TestDefaultIgnores(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		path string
+		want bool
+	}{
+		{"source", nil, "main.go", false},
+		{"nested source", nil, "internal/app/app.go", false},
+		{"git dir", nil, ".git", true},
+		{"git contents", nil, ".git/objects/ab/cdef", true},
+		{"nested git contents", nil, "vendor/lib/.git/HEAD", true},
+		{"mercurial", nil, ".hg/store", true},
+		{"subversion", nil, ".svn", true},
+		{"bazaar", nil, ".bzr", true},
+		{"jujutsu", nil, ".jj/repo", true},
+		{"vim swap", nil, "main.go.swp", true},
+		{"vim swap sequence", nil, ".main.go.swx", true},
+		{"vim backup", nil, "main.go~", true},
+		{"vim write probe", nil, "pkg/4913", true},
+		{"emacs auto-save", nil, "#main.go#", true},
+		{"emacs lock", nil, ".#main.go", true},
+		{"jetbrains safe write", nil, "main.go___jb_tmp___", true},
+		{"jetbrains old", nil, "main.go___jb_old___", true},
+		{"atomic save", nil, "main.go.tmp", true},
+		{"macos metadata", nil, ".DS_Store", true},
+		{"macos resource fork", nil, "._main.go", true},
+		{"windows thumbnails", nil, "assets/Thumbs.db", true},
+		{"windows folder settings", nil, "desktop.ini", true},
+		{"kde folder settings", nil, ".directory", true},
+		{"re-included", []string{"-x", "!*.tmp"}, "main.go.tmp", false},
+		{"re-include keeps the rest", []string{"-x", "!*.tmp"}, "main.go.swp", true},
+		{"disabled", []string{"-defaultIgnores=false"}, "main.go.swp", false},
+		{"disabled git", []string{"-defaultIgnores=false"}, ".git/HEAD", false},
+		{"disabled with excludes", []string{"-defaultIgnores=false", "-x", "*.swp"}, "main.go.swp", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parseTestFlags(t, tt.args)
+			matcher, err := dotignore.NewPatternMatcher(mergeIgnorePatterns(defaultIgnores(), excludes))
+			if err != nil {
+				t.Fatalf("NewPatternMatcher() error = %v", err)
+			}
+
+			got, err := matcher.Matches(tt.path)
+			if err != nil {
+				t.Fatalf("Matches(%q) error = %v", tt.path, err)
+			}
+			if got != tt.want {
+				t.Errorf("Matches(%q) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"io"
+	"log"
+	"log/slog"
+	"os"
+
+	"golang.org/x/term"
+)
+
+// keyHelp lists the keys understood in interactive mode
+const keyHelp = "Press r to rebuild, s to restart, p to pause, c to clear, l to toggle debug logs, q to quit"
+
+// keyAction is what a key press asks the session to do
+type keyAction int
+
+const (
+	keyNone keyAction = iota
+	keyRebuild
+	keyRestart
+	keyPause
+	keyClear
+	keyDebugLogs
+	keyQuit
+)
+
+// keyActionOf returns the action of a key, keyNone for keys without one
+func keyActionOf(key byte) keyAction {
+	switch key {
+	case 'r':
+		return keyRebuild
+	case 's':
+		return keyRestart
+	case 'p':
+		return keyPause
+	case 'c':
+		return keyClear
+	case 'l':
+		return keyDebugLogs
+	case 'q', 3: // Ctrl+C in raw mode
+		return keyQuit
+	default:
+		return keyNone
+	}
+}
+
+// listenKeys reads single key presses from stdin when it is a terminal. The
+// returned function restores the terminal and must be called before exiting.
+// Without a terminal, or in -noTTY mode, no keys are delivered.
+func listenKeys() (<-chan byte, func()) {
+	fd := int(os.Stdin.Fd())
+	if noTTY || !term.IsTerminal(fd) {
+		return nil, func() {}
+	}
+
+	restore, err := enableKeys(fd)
+	if err != nil {
+		slog.Debug("failed to enable interactive keys", slog.Any("error", err))
+		return nil, func() {}
+	}
+
+	keys := make(chan byte)
+	go func() {
+		// The goroutine is blocked reading stdin until the process exits
+		buf := make([]byte, 1)
+		for {
+			if _, err := os.Stdin.Read(buf); err != nil {
+				if err != io.EOF {
+					slog.Debug("failed to read key", slog.Any("error", err))
+				}
+				return
+			}
+			keys <- buf[0]
+		}
+	}()
+	log.Printf("[Pulse] %s\n", keyHelp)
+	return keys, restore
+}
+
+// clearScreen clears the terminal and moves the cursor to the top. It writes
+// to where pulse logs, stdout may carry JSON events.
+func clearScreen() {
+	io.WriteString(pulseOutput(), "\033[H\033[2J")
+}
+
+var (
+	baseLogLevel slog.Level
+	logLevel     slog.LevelVar
+	debugLogs    bool
+)
+
+// toggleDebugLogs switches between debug logging and the configured log level
+func toggleDebugLogs() {
+	debugLogs = !debugLogs
+	level := baseLogLevel
+	if debugLogs {
+		level = slog.LevelDebug
+	}
+
+	logLevel.Set(level)
+	if os.Getenv("LOG_LEVEL") == "" {
+		// Without LOG_LEVEL the default handler is in use
+		slog.SetLogLoggerLevel(level)
+	}
+	log.Printf("[Pulse] Log level %s\n", level)
+}
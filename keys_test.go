@@ -0,0 +1,27 @@
+package main
+
+import "testing"
+
+func TestKeyActionOf(t *testing.T) {
+	tests := []struct {
+		key  byte
+		want keyAction
+	}{
+		{'r', keyRebuild},
+		{'s', keyRestart},
+		{'p', keyPause},
+		{'c', keyClear},
+		{'l', keyDebugLogs},
+		{'q', keyQuit},
+		{3, keyQuit},
+		{'R', keyNone},
+		{'x', keyNone},
+		{'\n', keyNone},
+	}
+
+	for _, tt := range tests {
+		if got := keyActionOf(tt.key); got != tt.want {
+			t.Errorf("keyActionOf(%q) = %v, want %v", tt.key, got, tt.want)
+		}
+	}
+}
@@ -2,7 +2,12 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"log"
+	"os"
+	"slices"
+	"strings"
+	"time"
 )
 
 type excludeFlag []string
@@ -32,22 +37,151 @@ func (f *buildArgFlag) Set(v string) error {
 	return nil
 }
 
+type envFileFlag []string
+
+func (f *envFileFlag) String() string { return "" }
+
+func (f *envFileFlag) Set(v string) error {
+	*f = append(*f, v)
+	return nil
+}
+
+type envFlag []string
+
+func (f *envFlag) String() string { return "" }
+
+func (f *envFlag) Set(v string) error {
+	if !strings.Contains(v, "=") {
+		return fmt.Errorf("expected KEY=VALUE, got %q", v)
+	}
+	*f = append(*f, v)
+	return nil
+}
+
 var (
-	excludes    excludeFlag
-	buildArgs   buildArgFlag
-	watchDirs   watchDirFlag
-	workingDir  = *flag.String("cwd", ".", "Working directory of the executable.")
-	prebuildCmd = *flag.String("pbc", "", "Command to run before build.")
+	excludes          excludeFlag
+	useDefaultIgnores bool
+	buildArgs         buildArgFlag
+	watchDirs         watchDirFlag
+	workingDir        string
+	prebuildCmd       string
+	keepRunning       bool
+	pollInterval      time.Duration
+	pollHash          bool
+	configPath        string
+	profile           string
+	envVars           envFlag
+	envFiles          envFileFlag
+	rules             ruleFlag
+	generators        generatorFlag
+	targets           targetFlag
+	depGraph          bool
+	readyTCP          string
+	readyHTTP         string
+	readyStatus       int
+	readyLog          string
+	readyTimeout      time.Duration
+	proxyAddr         string
+	proxyTarget       string
+	liveReload        bool
+	ctlAddr           string
+	jsonMode          bool
+	jsonOut           string
+	stopSignal        string
+	stopTimeout       time.Duration
+	shutdownCmd       string
+	restartMode       string
+	restartMax        int
+	restartDelay      time.Duration
+	failedOnly        bool
+	noTTY             bool
+	debugMode         bool
+	debugAddr         string
+	coverDir          string
+	coverHTML         string
+	cacheSize         int
 )
 
+// splitArgs splits args before the -- terminator. flag.Parse consumes a --
+// that no positional argument comes before, so the rest must not be parsed.
+func splitArgs(args []string) (flagArgs, passThrough []string) {
+	if i := slices.Index(args, "--"); i >= 0 {
+		return args[:i], args[i:]
+	}
+	return args, nil
+}
+
 func main() {
+	args := os.Args[1:]
+	testMode := len(args) > 0 && args[0] == "test"
+	if testMode {
+		flag.BoolVar(&failedOnly, "failed", false, "Re-run only the tests that failed last time until they pass.")
+		args = args[1:]
+	}
+	ctlMode := len(args) > 0 && args[0] == "ctl"
+	if ctlMode {
+		args = args[1:]
+	}
+
 	flag.Var(&excludes, "x", "Exclude a directory or a file. can be set multiple times with gitignore pattern.")
+	flag.BoolVar(&useDefaultIgnores, "defaultIgnores", true, "Ignore editor temp and swap files, OS metadata files and version control directories.")
 	flag.Var(&buildArgs, "buildArgs", "Additional go build arguments.")
 	flag.Var(&watchDirs, "wd", "Watching directory.")
-	flag.Parse()
-	args := flag.Args()
+	flag.Var(&envFiles, "envFile", "Dotenv file loaded into the environment of the executable. Edits restart it without a rebuild. can be set multiple times.")
+	flag.Var(&envVars, "env", "KEY=VALUE environment variable for the executable. can be set multiple times.")
+	flag.Var(&rules, "rule", "PATTERN=ACTION rule deciding what a change to matching files does: rebuild, restart, run:COMMAND or ignore. can be set multiple times, the last matching rule wins.")
+	flag.Var(&generators, "gen", "PATTERN:OUTPUT[,...]=COMMAND code generator run before the build when matching files change. OUTPUT patterns are excluded from watching. can be set multiple times.")
+	flag.Var(&targets, "target", "NAME=PACKAGE target to build and run alongside the others, its output is prefixed with its name. can be set multiple times.")
+	flag.BoolVar(&depGraph, "depGraph", true, "Only rebuild targets whose import graph contains the changed Go files.")
+	flag.StringVar(&workingDir, "cwd", ".", "Working directory of the executable.")
+	flag.StringVar(&prebuildCmd, "pbc", "", "Command to run before build.")
+	flag.BoolVar(&keepRunning, "keepRunning", false, "Keep the previous process running until the new build succeeds.")
+	flag.DurationVar(&pollInterval, "poll", 0, "Poll for changes at the given interval instead of using fsnotify, e.g. 500ms.")
+	flag.BoolVar(&pollHash, "pollHash", false, "Compare content hashes when polling, in addition to mtime and size.")
+	flag.StringVar(&readyTCP, "readyTCP", "", "Address that has to accept TCP connections for the process to be ready, e.g. localhost:8080.")
+	flag.StringVar(&readyHTTP, "readyHTTP", "", "URL that has to answer a GET request for the process to be ready.")
+	flag.IntVar(&readyStatus, "readyStatus", 200, "Expected status code of the -readyHTTP URL.")
+	flag.StringVar(&readyLog, "readyLog", "", "Regular expression an output line has to match for the process to be ready.")
+	flag.DurationVar(&readyTimeout, "readyTimeout", 10*time.Second, "How long to wait for the process to become ready.")
+	flag.StringVar(&proxyAddr, "proxy", "", "Serve a reverse proxy on this address that holds requests while rebuilding, e.g. :3000.")
+	flag.StringVar(&proxyTarget, "proxyTarget", "http://localhost:8080", "URL of the application the proxy forwards to.")
+	flag.BoolVar(&liveReload, "liveReload", false, "Reload browser pages served through -proxy after every successful restart.")
+	flag.StringVar(&ctlAddr, "ctl", "", "Serve the control API on this Unix socket path or localhost address, e.g. .pulse.sock or localhost:7070.")
+	flag.BoolVar(&jsonMode, "json", false, "Emit newline-delimited JSON lifecycle events.")
+	flag.StringVar(&jsonOut, "jsonOut", "-", "Where -json events are written, a file or FIFO path, or - for stdout.")
+	flag.StringVar(&stopSignal, "stopSignal", "SIGINT", "Signal sent to the process to stop it, e.g. SIGTERM.")
+	flag.DurationVar(&stopTimeout, "stopTimeout", 3*time.Second, "How long the process may take to shut down gracefully before it is killed.")
+	flag.StringVar(&shutdownCmd, "shutdownCmd", "", "Command run to stop the process instead of sending the stop signal. PULSE_PID holds its pid.")
+	flag.StringVar(&restartMode, "restart", "never", "Restart policy for a process that exits on its own: never, on-failure or always.")
+	flag.IntVar(&restartMax, "restartRetries", 5, "Consecutive restarts of a crashing process before giving up, 0 for no limit.")
+	flag.DurationVar(&restartDelay, "restartBackoff", 500*time.Millisecond, "Delay before the first restart, doubled on every consecutive restart.")
+	flag.BoolVar(&debugMode, "debug", false, "Build without optimizations and run the executable under a headless dlv server, restarted with every rebuild.")
+	flag.StringVar(&debugAddr, "debugAddr", "127.0.0.1:2345", "Address of the dlv server. Every further target gets the next port.")
+	flag.IntVar(&cacheSize, "cacheSize", 0, "Cache built binaries up to this size in MB, e.g. 1024. 0 disables the cache.")
+	flag.StringVar(&coverDir, "cover", "", "Build with coverage instrumentation and merge the coverage of every run into this directory.")
+	flag.StringVar(&coverHTML, "coverHTML", "", "Also write the merged -cover report as HTML to this file.")
+	flag.BoolVar(&noTTY, "noTTY", false, "Disable interactive keys and forward stdin to the executable instead.")
+	flag.StringVar(&configPath, "config", "", "Path to the config file. Defaults to pulse.toml, pulse.yaml or pulse.yml in the current directory.")
+	flag.StringVar(&profile, "profile", "", "Named profile from the config file to apply.")
+	flagArgs, passThrough := splitArgs(args)
+	flag.CommandLine.Parse(flagArgs)
+	positional := append(flag.Args(), passThrough...)
 
-	if err := run(args); err != nil {
+	args, err := applyConfig(positional)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	switch {
+	case testMode:
+		// Package patterns and go test arguments come from the command line only
+		err = runTest(positional)
+	case ctlMode:
+		err = runCtl(positional)
+	default:
+		err = run(args)
+	}
+	if err != nil {
 		log.Fatal(err)
 	}
 }
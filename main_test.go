@@ -0,0 +1,37 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"slices"
+	"testing"
+)
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		args           []string
+		wantPositional []string
+		wantPbc        string
+	}{
+		{[]string{"-pbc", "make", "./cmd/app"}, []string{"./cmd/app"}, "make"},
+		{[]string{"-pbc", "make", "./cmd/app", "--", "-v"}, []string{"./cmd/app", "--", "-v"}, "make"},
+		// flag.Parse alone would drop the --
+		{[]string{"-pbc", "make", "--", "-race", "-count=1"}, []string{"--", "-race", "-count=1"}, "make"},
+		{[]string{"--", "-pbc", "x"}, []string{"--", "-pbc", "x"}, ""},
+	}
+
+	for _, tt := range tests {
+		fs := flag.NewFlagSet("pulse", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		pbc := fs.String("pbc", "", "")
+
+		flagArgs, passThrough := splitArgs(tt.args)
+		if err := fs.Parse(flagArgs); err != nil {
+			t.Fatalf("Parse(%q) error = %v", flagArgs, err)
+		}
+		positional := append(fs.Args(), passThrough...)
+		if !slices.Equal(positional, tt.wantPositional) || *pbc != tt.wantPbc {
+			t.Errorf("splitArgs(%q) parsed to %q with -pbc %q, want %q with %q", tt.args, positional, *pbc, tt.wantPositional, tt.wantPbc)
+		}
+	}
+}
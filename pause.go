@@ -0,0 +1,47 @@
+package main
+
+import (
+	"slices"
+
+	"github.com/panotza/pulse/watcher"
+)
+
+// pauseState holds back the changes made while the session is paused so
+// they can be handled at once when it resumes
+type pauseState struct {
+	paused bool
+	// missed collects the changes made while paused, one entry per path
+	missed watcher.ChangeSet
+}
+
+// hold reports whether changeSet is held back because the session is paused.
+// The initial change set is never held back.
+func (p *pauseState) hold(changeSet watcher.ChangeSet) bool {
+	if !p.paused || changeSet.Initial {
+		return false
+	}
+
+	p.missed.Time = changeSet.Time
+	for _, c := range changeSet.Changes {
+		i := slices.IndexFunc(p.missed.Changes, func(m watcher.Change) bool { return m.Path == c.Path })
+		if i < 0 {
+			p.missed.Changes = append(p.missed.Changes, c)
+			continue
+		}
+		p.missed.Changes[i].Op |= c.Op
+	}
+	return true
+}
+
+// set pauses or resumes the session and reports whether that changed its
+// state. On resume it also returns the changes held back while paused.
+func (p *pauseState) set(paused bool) (bool, watcher.ChangeSet) {
+	if paused == p.paused {
+		return false, watcher.ChangeSet{}
+	}
+
+	p.paused = paused
+	missed := p.missed
+	p.missed = watcher.ChangeSet{}
+	return true, missed
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/panotza/pulse/watcher"
+)
+
+func TestPauseState(t *testing.T) {
+	var p pauseState
+	at := time.Now()
+	changeSet := func(path string, op fsnotify.Op) watcher.ChangeSet {
+		at = at.Add(time.Second)
+		return watcher.ChangeSet{Time: at, Changes: []watcher.Change{{Path: path, Op: op}}}
+	}
+
+	if p.hold(changeSet("a.go", fsnotify.Write)) {
+		t.Fatal("hold() = true while running")
+	}
+	if changed, _ := p.set(false); changed {
+		t.Error("set(false) while running = true, want false")
+	}
+
+	if changed, _ := p.set(true); !changed {
+		t.Fatal("set(true) = false, want true")
+	}
+	for _, cs := range []watcher.ChangeSet{
+		changeSet("a.go", fsnotify.Create),
+		changeSet("b.go", fsnotify.Write),
+		changeSet("a.go", fsnotify.Write),
+	} {
+		if !p.hold(cs) {
+			t.Fatalf("hold(%s) = false while paused", cs)
+		}
+	}
+	if p.hold(watcher.ChangeSet{Initial: true}) {
+		t.Error("hold() of the initial change set = true")
+	}
+	if changed, _ := p.set(true); changed {
+		t.Error("set(true) while paused = true, want false")
+	}
+
+	// Resuming replays every path once, in order of the first change
+	changed, missed := p.set(false)
+	if !changed {
+		t.Fatal("set(false) = false, want true")
+	}
+	want := []watcher.Change{{Path: "a.go", Op: fsnotify.Create | fsnotify.Write}, {Path: "b.go", Op: fsnotify.Write}}
+	if !slices.Equal(missed.Changes, want) || !missed.Time.Equal(at) {
+		t.Errorf("missed = %v at %s, want %v at %s", missed.Changes, missed.Time, want, at)
+	}
+
+	// The replayed changes are not replayed again
+	p.set(true)
+	if _, missed := p.set(false); len(missed.Changes) != 0 {
+		t.Errorf("missed after an empty pause = %v, want none", missed.Changes)
+	}
+}
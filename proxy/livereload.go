@@ -0,0 +1,151 @@
+package proxy
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	liveReloadPrefix     = "/__pulse/"
+	liveReloadScriptPath = liveReloadPrefix + "livereload.js"
+	liveReloadEventsPath = liveReloadPrefix + "events"
+)
+
+//go:embed livereload.js
+var liveReloadScript []byte
+
+var liveReloadTag = []byte(`<script src="` + liveReloadScriptPath + `"></script>`)
+
+// liveReloadEvent is a server-sent event delivered to connected browsers
+type liveReloadEvent struct {
+	name string
+	data string
+}
+
+// liveReload keeps track of connected browsers and broadcasts events to them
+type liveReload struct {
+	mu      sync.Mutex
+	clients map[chan liveReloadEvent]struct{}
+}
+
+func newLiveReload() *liveReload {
+	return &liveReload{
+		clients: make(map[chan liveReloadEvent]struct{}),
+	}
+}
+
+// broadcast delivers an event to every connected browser. Slow clients miss events
+// rather than blocking the broadcaster.
+func (lr *liveReload) broadcast(name, data string) {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+
+	for client := range lr.clients {
+		select {
+		case client <- liveReloadEvent{name: name, data: data}:
+		default:
+		}
+	}
+}
+
+func (lr *liveReload) subscribe() chan liveReloadEvent {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+
+	client := make(chan liveReloadEvent, 4)
+	lr.clients[client] = struct{}{}
+	return client
+}
+
+func (lr *liveReload) unsubscribe(client chan liveReloadEvent) {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+
+	delete(lr.clients, client)
+}
+
+func (lr *liveReload) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case liveReloadScriptPath:
+		w.Header().Set("Content-Type", "text/javascript; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		_, _ = w.Write(liveReloadScript)
+	case liveReloadEventsPath:
+		lr.serveEvents(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (lr *liveReload) serveEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	client := lr.subscribe()
+	defer lr.unsubscribe(client)
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event := <-client:
+			fmt.Fprintf(w, "event: %s\n", event.name)
+			for _, line := range strings.Split(event.data, "\n") {
+				fmt.Fprintf(w, "data: %s\n", line)
+			}
+			fmt.Fprint(w, "\n")
+			flusher.Flush()
+		}
+	}
+}
+
+// injectScript adds the live reload script tag to text/html responses
+func injectScript(resp *http.Response) error {
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") {
+		return nil
+	}
+	if enc := resp.Header.Get("Content-Encoding"); enc != "" && enc != "identity" {
+		return nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	body = insertBeforeBodyEnd(body, liveReloadTag)
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	return nil
+}
+
+// insertBeforeBodyEnd inserts tag before the last closing body tag, or appends
+// it when the document has none
+func insertBeforeBodyEnd(body, tag []byte) []byte {
+	i := bytes.LastIndex(bytes.ToLower(body), []byte("</body>"))
+	if i < 0 {
+		return append(body, tag...)
+	}
+
+	out := make([]byte, 0, len(body)+len(tag))
+	out = append(out, body[:i]...)
+	out = append(out, tag...)
+	return append(out, body[i:]...)
+}
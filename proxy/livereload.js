@@ -0,0 +1,35 @@
+(function () {
+  var overlay = null;
+
+  function hideOverlay() {
+    if (overlay) {
+      overlay.remove();
+      overlay = null;
+    }
+  }
+
+  function showOverlay(message) {
+    hideOverlay();
+    overlay = document.createElement("div");
+    overlay.style.cssText =
+      "position:fixed;inset:0;z-index:2147483647;overflow:auto;padding:2em;" +
+      "background:rgba(20,20,20,0.95);color:#ddd;font:14px/1.5 monospace;";
+    var title = document.createElement("h2");
+    title.textContent = "Build failed";
+    title.style.cssText = "color:#f66;margin-top:0;font-family:sans-serif;";
+    var pre = document.createElement("pre");
+    pre.textContent = message;
+    pre.style.cssText = "white-space:pre-wrap;";
+    overlay.appendChild(title);
+    overlay.appendChild(pre);
+    document.body.appendChild(overlay);
+  }
+
+  var source = new EventSource("/__pulse/events");
+  source.addEventListener("reload", function () {
+    location.reload();
+  });
+  source.addEventListener("build-error", function (e) {
+    showOverlay(e.data);
+  });
+})();
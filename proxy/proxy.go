@@ -0,0 +1,256 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultHoldTimeout is how long a request is held while a build or restart is in progress
+const DefaultHoldTimeout = 30 * time.Second
+
+type state int
+
+const (
+	stateHolding state = iota
+	stateReady
+	stateFailed
+)
+
+// Proxy is a reverse proxy in front of the application process. While a build or
+// restart is in progress incoming requests are held and forwarded once the new
+// process is ready. When the build failed an error page is served instead.
+type Proxy struct {
+	target      *url.URL
+	reverse     *httputil.ReverseProxy
+	holdTimeout time.Duration
+	logger      *slog.Logger
+	liveReload  *liveReload
+
+	mu      sync.Mutex
+	state   state
+	err     error
+	changed chan struct{}
+}
+
+// Option defines a function type for configuring Proxy
+type Option func(*Proxy)
+
+// WithHoldTimeout sets how long a request is held before giving up
+func WithHoldTimeout(timeout time.Duration) Option {
+	return func(p *Proxy) {
+		p.holdTimeout = timeout
+	}
+}
+
+// WithLogger sets the logger for the proxy
+func WithLogger(logger *slog.Logger) Option {
+	return func(p *Proxy) {
+		p.logger = logger
+	}
+}
+
+// WithLiveReload injects a script into text/html responses that reloads the page
+// after every successful restart and shows an overlay when the build fails
+func WithLiveReload() Option {
+	return func(p *Proxy) {
+		p.liveReload = newLiveReload()
+	}
+}
+
+// New creates a new Proxy forwarding to target. The proxy starts out holding
+// requests until the first build is ready.
+func New(target string, options ...Option) (*Proxy, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, fmt.Errorf("parse proxy target %s: %w", target, err)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("proxy target %s must be an absolute URL", target)
+	}
+
+	p := &Proxy{
+		target:      u,
+		reverse:     httputil.NewSingleHostReverseProxy(u),
+		holdTimeout: DefaultHoldTimeout,
+		logger:      slog.New(slog.DiscardHandler),
+		state:       stateHolding,
+		changed:     make(chan struct{}),
+	}
+
+	for _, option := range options {
+		option(p)
+	}
+
+	if p.liveReload != nil {
+		director := p.reverse.Director
+		p.reverse.Director = func(r *http.Request) {
+			director(r)
+			// Compressed bodies can't be rewritten, ask for an uncompressed response
+			r.Header.Del("Accept-Encoding")
+		}
+		p.reverse.ModifyResponse = injectScript
+	}
+	return p, nil
+}
+
+// TargetAddr returns the host:port requests are forwarded to
+func (p *Proxy) TargetAddr() string {
+	if p.target.Port() != "" {
+		return p.target.Host
+	}
+	if p.target.Scheme == "https" {
+		return net.JoinHostPort(p.target.Hostname(), "443")
+	}
+	return net.JoinHostPort(p.target.Hostname(), "80")
+}
+
+// Hold makes the proxy hold incoming requests until Release or Fail is called
+func (p *Proxy) Hold() {
+	p.setState(stateHolding, nil)
+}
+
+// Release forwards held and incoming requests to the target. With live reload
+// enabled, connected browsers are told to reload.
+func (p *Proxy) Release() {
+	if p.setState(stateReady, nil) && p.liveReload != nil {
+		p.liveReload.broadcast("reload", "")
+	}
+}
+
+// Fail answers held and incoming requests with an error page describing err
+func (p *Proxy) Fail(err error) {
+	p.setState(stateFailed, err)
+	p.ShowError(err)
+}
+
+// ShowError shows err in an overlay in connected browsers without changing how
+// requests are handled. It does nothing unless live reload is enabled.
+func (p *Proxy) ShowError(err error) {
+	if p.liveReload != nil && err != nil {
+		p.liveReload.broadcast("build-error", err.Error())
+	}
+}
+
+// setState switches to state s and wakes up held requests. It reports whether
+// the state changed.
+func (p *Proxy) setState(s state, err error) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.state == s && p.err == err {
+		return false
+	}
+	p.state = s
+	p.err = err
+	close(p.changed)
+	p.changed = make(chan struct{})
+	return true
+}
+
+func (p *Proxy) current() (state, <-chan struct{}, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.state, p.changed, p.err
+}
+
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if p.liveReload != nil && strings.HasPrefix(r.URL.Path, liveReloadPrefix) {
+		p.liveReload.ServeHTTP(w, r)
+		return
+	}
+
+	timeout := time.NewTimer(p.holdTimeout)
+	defer timeout.Stop()
+
+	for {
+		s, changed, err := p.current()
+		switch s {
+		case stateReady:
+			p.reverse.ServeHTTP(w, r)
+			return
+		case stateFailed:
+			p.writeErrorPage(w, http.StatusBadGateway, "Build failed", err)
+			return
+		}
+
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return
+		case <-timeout.C:
+			p.writeErrorPage(w, http.StatusGatewayTimeout, "Still rebuilding", fmt.Errorf("the application was not ready after %s", p.holdTimeout))
+			return
+		}
+	}
+}
+
+// ListenAndServe serves the proxy on addr until ctx is done
+func (p *Proxy) ListenAndServe(ctx context.Context, addr string) error {
+	srv := &http.Server{
+		Addr:    addr,
+		Handler: p,
+		BaseContext: func(net.Listener) context.Context {
+			return ctx
+		},
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
+	p.logger.DebugContext(ctx, "proxy listening", slog.String("addr", addr), slog.String("target", p.target.String()))
+	err := srv.ListenAndServe()
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+var errorPage = template.Must(template.New("error").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}} - Pulse</title>
+<style>
+body { font-family: sans-serif; margin: 2em; background: #1e1e1e; color: #ddd; }
+h1 { color: #f66; }
+pre { background: #111; padding: 1em; overflow: auto; white-space: pre-wrap; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<pre>{{.Message}}</pre>
+{{if .LiveReload}}<script src="{{.Script}}"></script>{{end}}
+</body>
+</html>
+`))
+
+func (p *Proxy) writeErrorPage(w http.ResponseWriter, status int, title string, err error) {
+	message := "unknown error"
+	if err != nil {
+		message = err.Error()
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = errorPage.Execute(w, struct {
+		Title      string
+		Message    string
+		LiveReload bool
+		Script     string
+	}{title, message, p.liveReload != nil, liveReloadScriptPath})
+}
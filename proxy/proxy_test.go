@@ -0,0 +1,115 @@
+package proxy
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProxy_ServeHTTP(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		io.WriteString(w, "<html><body>hello</body></html>")
+	}))
+	defer backend.Close()
+
+	t.Run("HoldUntilRelease", func(t *testing.T) {
+		p, err := New(backend.URL)
+		if err != nil {
+			t.Fatalf("Failed to create Proxy: %v", err)
+		}
+
+		done := make(chan *httptest.ResponseRecorder)
+		go func() {
+			rec := httptest.NewRecorder()
+			p.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+			done <- rec
+		}()
+
+		select {
+		case <-done:
+			t.Fatal("Expected request to be held")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		p.Release()
+
+		select {
+		case rec := <-done:
+			if rec.Code != http.StatusOK {
+				t.Errorf("Expected status 200, got %d", rec.Code)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Timed out waiting for held request")
+		}
+	})
+
+	t.Run("Fail", func(t *testing.T) {
+		p, err := New(backend.URL)
+		if err != nil {
+			t.Fatalf("Failed to create Proxy: %v", err)
+		}
+		p.Fail(errors.New("main.go:1:1: <oops>"))
+
+		rec := httptest.NewRecorder()
+		p.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		if rec.Code != http.StatusBadGateway {
+			t.Errorf("Expected status 502, got %d", rec.Code)
+		}
+		if !strings.Contains(rec.Body.String(), "main.go:1:1: &lt;oops&gt;") {
+			t.Errorf("Expected escaped error in page, got %s", rec.Body.String())
+		}
+	})
+
+	t.Run("HoldTimeout", func(t *testing.T) {
+		p, err := New(backend.URL, WithHoldTimeout(10*time.Millisecond))
+		if err != nil {
+			t.Fatalf("Failed to create Proxy: %v", err)
+		}
+
+		rec := httptest.NewRecorder()
+		p.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		if rec.Code != http.StatusGatewayTimeout {
+			t.Errorf("Expected status 504, got %d", rec.Code)
+		}
+	})
+
+	t.Run("LiveReloadInjection", func(t *testing.T) {
+		p, err := New(backend.URL, WithLiveReload())
+		if err != nil {
+			t.Fatalf("Failed to create Proxy: %v", err)
+		}
+		p.Release()
+
+		rec := httptest.NewRecorder()
+		p.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		want := `<html><body>hello<script src="/__pulse/livereload.js"></script></body></html>`
+		if rec.Body.String() != want {
+			t.Errorf("Expected %s, got %s", want, rec.Body.String())
+		}
+	})
+}
+
+func TestInsertBeforeBodyEnd(t *testing.T) {
+	tests := []struct {
+		body string
+		want string
+	}{
+		{"<body>a</body>", "<body>a<x></body>"},
+		{"<BODY>a</BODY>", "<BODY>a<x></BODY>"},
+		{"a", "a<x>"},
+	}
+
+	for _, tt := range tests {
+		if got := string(insertBeforeBodyEnd([]byte(tt.body), []byte("<x>"))); got != tt.want {
+			t.Errorf("insertBeforeBodyEnd(%q) = %q, want %q", tt.body, got, tt.want)
+		}
+	}
+}
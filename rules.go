@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/codeglyph/go-dotignore"
+	"github.com/panotza/pulse/watcher"
+	"github.com/panotza/pulse/work"
+)
+
+// ruleAction is what happens when a changed file matches a rule. Actions are
+// ordered by cost, a change set takes the most expensive action of its files.
+type ruleAction int
+
+const (
+	actionIgnore ruleAction = iota
+	actionRun
+	actionRestart
+	actionRebuild
+)
+
+var ruleActionNames = map[string]ruleAction{
+	"ignore":  actionIgnore,
+	"run":     actionRun,
+	"restart": actionRestart,
+	"rebuild": actionRebuild,
+}
+
+func (a ruleAction) String() string {
+	for name, action := range ruleActionNames {
+		if action == a {
+			return name
+		}
+	}
+	return fmt.Sprintf("ruleAction(%d)", int(a))
+}
+
+// rule maps files matching a gitignore style pattern to an action
+type rule struct {
+	pattern string
+	action  ruleAction
+	command string
+	matcher *dotignore.PatternMatcher
+}
+
+// newRule creates a rule. command is required for the run action and not
+// allowed for any other.
+func newRule(pattern, action, command string) (rule, error) {
+	if pattern == "" {
+		return rule{}, fmt.Errorf("rule with action %q has no pattern", action)
+	}
+	a, ok := ruleActionNames[action]
+	if !ok {
+		return rule{}, fmt.Errorf("rule %s: unsupported action %q, want rebuild, restart, run or ignore", pattern, action)
+	}
+	if a == actionRun && command == "" {
+		return rule{}, fmt.Errorf("rule %s: run action requires a command", pattern)
+	}
+	if a != actionRun && command != "" {
+		return rule{}, fmt.Errorf("rule %s: only the run action takes a command", pattern)
+	}
+
+	matcher, err := dotignore.NewPatternMatcher([]string{pattern})
+	if err != nil {
+		return rule{}, fmt.Errorf("rule %s: %w", pattern, err)
+	}
+	return rule{pattern: pattern, action: a, command: command, matcher: matcher}, nil
+}
+
+// parseRule parses PATTERN=ACTION, where ACTION is rebuild, restart, ignore or
+// run:COMMAND
+func parseRule(s string) (rule, error) {
+	pattern, action, ok := strings.Cut(s, "=")
+	if !ok || pattern == "" {
+		return rule{}, fmt.Errorf("expected PATTERN=ACTION, got %q", s)
+	}
+	action, command, _ := strings.Cut(action, ":")
+	return newRule(pattern, action, command)
+}
+
+func (r rule) matches(path string) bool {
+	ok, err := r.matcher.Matches(path)
+	return err == nil && ok
+}
+
+type ruleFlag []rule
+
+func (f *ruleFlag) String() string { return "" }
+
+func (f *ruleFlag) Set(v string) error {
+	r, err := parseRule(v)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, r)
+	return nil
+}
+
+// plan is the work a change set requires
+type plan struct {
+	action   ruleAction
+	commands []string
+}
+
+// merge returns the plan doing the work of both p and o
+func (p plan) merge(o plan) plan {
+	p.action = max(p.action, o.action)
+	for _, c := range o.commands {
+		if !slices.Contains(p.commands, c) {
+			p.commands = append(p.commands, c)
+		}
+	}
+	return p
+}
+
+// forTarget returns the plan for a target whose last build succeeded or not.
+// Without a good binary there is nothing to restart, so a restart becomes a rebuild.
+func (p plan) forTarget(lastBuildOK bool) plan {
+	if p.action == actionRestart && !lastBuildOK {
+		p.action = actionRebuild
+	}
+	return p
+}
+
+// planner decides what to do about a change set
+type planner struct {
+	rules      []rule
+	generators []generator
+	envFiles   []string
+
+	// deps, if set, skips files outside the import graph of packagePath
+	deps        *work.DepGraph
+	packagePath string
+}
+
+// plan returns the work a change set requires. Files are matched against the
+// rules relative to the current directory, and like in gitignore files the
+// last matching rule wins. Env files no rule matches require a restart, any
+// other file a rebuild unless it is outside the import graph of the target.
+// Generators of matching files run before the rebuild.
+func (pl planner) plan(changeSet watcher.ChangeSet) plan {
+	if changeSet.Initial {
+		return plan{action: actionRebuild}
+	}
+
+	var p plan
+	for _, c := range changeSet.Changes {
+		path := relPath(c.Path)
+
+		fileAction := plan{action: actionRebuild}
+		switch {
+		case slices.ContainsFunc(pl.envFiles, func(envFile string) bool { return samePath(c.Path, envFile) }):
+			fileAction.action = actionRestart
+		case pl.deps != nil && !pl.deps.Affects(pl.packagePath, c.Path):
+			fileAction.action = actionIgnore
+		}
+		for i := len(pl.rules) - 1; i >= 0; i-- {
+			if pl.rules[i].matches(path) {
+				fileAction = plan{action: pl.rules[i].action}
+				if pl.rules[i].command != "" {
+					fileAction.commands = []string{pl.rules[i].command}
+				}
+				break
+			}
+		}
+		for _, g := range pl.generators {
+			if g.matches(path) {
+				fileAction = fileAction.merge(plan{action: actionRebuild, commands: []string{g.command}})
+			}
+		}
+		p = p.merge(fileAction)
+	}
+	return p
+}
+
+// relPath returns path relative to the current directory when possible
+func relPath(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	cwd, err := filepath.Abs(".")
+	if err != nil {
+		return path
+	}
+	rel, err := filepath.Rel(cwd, abs)
+	if err != nil {
+		return path
+	}
+	return filepath.ToSlash(rel)
+}
+
+// runRuleCommands runs the commands of run rules and generators one after
+// another in the current directory and stops at the first failure. ran counts
+// the commands that completed.
+func runRuleCommands(ctx context.Context, commands []string, events work.EventHandler, ran *atomic.Int32) error {
+	for _, command := range commands {
+		log.Printf("[Pulse] %s\n", command)
+		events.Emit(work.Event{Type: work.EventCommandStart, Command: command})
+		start := time.Now()
+
+		err := work.RunCommand(ctx, ".", command, pulseOutput())
+		end := work.Event{Type: work.EventCommandEnd, Command: command, DurationMS: time.Since(start).Milliseconds()}
+		if err != nil {
+			end.Error = err.Error()
+		}
+		events.Emit(end)
+
+		if err != nil {
+			return fmt.Errorf("command %q failed: %w", command, err)
+		}
+		ran.Add(1)
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/panotza/pulse/watcher"
+)
+
+func TestParseRule(t *testing.T) {
+	tests := []struct {
+		in          string
+		wantPattern string
+		wantAction  ruleAction
+		wantCommand string
+		wantErr     bool
+	}{
+		{in: "*.sql=restart", wantPattern: "*.sql", wantAction: actionRestart},
+		{in: "assets/=ignore", wantPattern: "assets/", wantAction: actionIgnore},
+		{in: "*.tmpl=run:make gen", wantPattern: "*.tmpl", wantAction: actionRun, wantCommand: "make gen"},
+		{in: "*.proto=run:protoc -I=. --go_out=paths=source_relative:gen x.proto", wantPattern: "*.proto", wantAction: actionRun, wantCommand: "protoc -I=. --go_out=paths=source_relative:gen x.proto"},
+		{in: "*.sql", wantErr: true},
+		{in: "=rebuild", wantErr: true},
+		{in: "*.sql=reload", wantErr: true},
+		{in: "*.tmpl=run", wantErr: true},
+		{in: "*.tmpl=run:", wantErr: true},
+		{in: "*.sql=restart:make", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		r, err := parseRule(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseRule(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if r.pattern != tt.wantPattern || r.action != tt.wantAction || r.command != tt.wantCommand {
+			t.Errorf("parseRule(%q) = %s %s %q, want %s %s %q", tt.in, r.pattern, r.action, r.command, tt.wantPattern, tt.wantAction, tt.wantCommand)
+		}
+	}
+}
+
+func TestPlan_Merge(t *testing.T) {
+	p := plan{action: actionRun, commands: []string{"a", "b"}}.
+		merge(plan{action: actionRestart, commands: []string{"b", "c"}}).
+		merge(plan{action: actionIgnore})
+
+	if p.action != actionRestart {
+		t.Errorf("action = %s, want restart", p.action)
+	}
+	if want := []string{"a", "b", "c"}; !slices.Equal(p.commands, want) {
+		t.Errorf("commands = %q, want %q", p.commands, want)
+	}
+}
+
+func TestPlan_ForTarget(t *testing.T) {
+	tests := []struct {
+		action      ruleAction
+		lastBuildOK bool
+		want        ruleAction
+	}{
+		{actionRestart, true, actionRestart},
+		{actionRestart, false, actionRebuild},
+		{actionRebuild, true, actionRebuild},
+		{actionRun, false, actionRun},
+		{actionIgnore, false, actionIgnore},
+	}
+
+	for _, tt := range tests {
+		if got := (plan{action: tt.action}).forTarget(tt.lastBuildOK).action; got != tt.want {
+			t.Errorf("plan{%s}.forTarget(%v) = %s, want %s", tt.action, tt.lastBuildOK, got, tt.want)
+		}
+	}
+}
+
+func mustRules(t *testing.T, specs ...string) []rule {
+	t.Helper()
+	var rules []rule
+	for _, s := range specs {
+		r, err := parseRule(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rules = append(rules, r)
+	}
+	return rules
+}
+
+func changeSetOf(paths ...string) watcher.ChangeSet {
+	var cs watcher.ChangeSet
+	for _, p := range paths {
+		cs.Changes = append(cs.Changes, watcher.Change{Path: p, Op: fsnotify.Write})
+	}
+	return cs
+}
+
+func TestPlanner_Plan(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	pl := planner{
+		rules: mustRules(t,
+			"*.sql=restart",
+			"migrations/*.sql=ignore",
+			"*.tmpl=run:make templates",
+			".env.local=rebuild",
+		),
+		envFiles: []string{".env", ".env.local"},
+	}
+
+	tests := []struct {
+		name         string
+		changeSet    watcher.ChangeSet
+		wantAction   ruleAction
+		wantCommands []string
+	}{
+		{"Initial", watcher.ChangeSet{Initial: true}, actionRebuild, nil},
+		{"NoMatchingRule", changeSetOf("main.go"), actionRebuild, nil},
+		{"Rule", changeSetOf("queries.sql"), actionRestart, nil},
+		{"LastMatchWins", changeSetOf("migrations/001.sql"), actionIgnore, nil},
+		{"RunCommand", changeSetOf("page.tmpl"), actionRun, []string{"make templates"}},
+		{"EnvFileRestarts", changeSetOf(".env"), actionRestart, nil},
+		{"RuleOverEnvFile", changeSetOf(".env.local"), actionRebuild, nil},
+		{"MostExpensiveAction", changeSetOf("page.tmpl", "queries.sql", "migrations/001.sql"), actionRestart, []string{"make templates"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := pl.plan(tt.changeSet)
+			if p.action != tt.wantAction {
+				t.Errorf("action = %s, want %s", p.action, tt.wantAction)
+			}
+			if !slices.Equal(p.commands, tt.wantCommands) {
+				t.Errorf("commands = %q, want %q", p.commands, tt.wantCommands)
+			}
+		})
+	}
+}
@@ -5,120 +5,652 @@ import (
 	"crypto/md5"
 	"encoding/hex"
 	"fmt"
+	"io"
 	"log"
 	"log/slog"
 	"os"
+	"os/exec"
 	"os/signal"
 	"path/filepath"
+	"regexp"
 	"runtime"
 	"slices"
 	"strings"
+	"sync"
+	"sync/atomic"
 
+	"github.com/panotza/pulse/proxy"
 	"github.com/panotza/pulse/watcher"
 	"github.com/panotza/pulse/work"
 )
 
 func run(args []string) error {
-	var err error
+	err := setupLogging()
+	if err != nil {
+		return err
+	}
 
-	// Configure slog with the specified log level
-	if s := os.Getenv("LOG_LEVEL"); s != "" {
-		var lv slog.Level
-		err := lv.UnmarshalText([]byte(s))
+	specs, err := resolveTargets(args)
+	if err != nil {
+		return err
+	}
+	var allEnvFiles []string
+	for _, spec := range specs {
+		for _, envFile := range spec.envFiles {
+			if !slices.Contains(allEnvFiles, envFile) {
+				allEnvFiles = append(allEnvFiles, envFile)
+			}
+		}
+	}
+
+	// Env files are usually gitignored but still have to be watched, generated
+	// files and what pulse writes itself must not trigger another cycle
+	ignorePatterns := mergeIgnorePatterns(defaultIgnores(), readGitIgnore(), readPulseIgnore(), excludes, envFileExceptions(allEnvFiles), generatorOutputs(generators), outputPatterns())
+
+	if coverHTML != "" && coverDir == "" {
+		return fmt.Errorf("coverage html requires coverage to be enabled with -cover")
+	}
+	// The coverage directory is created before watching starts so its
+	// creation doesn't trigger a cycle
+	var coverage *work.Coverage
+	if coverDir != "" {
+		var coverageOptions []work.CoverageOption
+		if coverHTML != "" {
+			coverageOptions = append(coverageOptions, work.WithCoverageHTML(coverHTML))
+		}
+		coverage, err = work.NewCoverage(coverDir, coverageOptions...)
 		if err != nil {
 			return err
 		}
-
-		handler := slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
-			Level: lv,
-		})
-		slog.SetDefault(slog.New(handler))
 	}
 
-	packagePath := "."
-	if len(args) > 0 {
-		packagePath = args[0]
-		args = args[1:]
-	}
+	ctx, shutdown := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer shutdown()
 
-	packagePath, err = filepath.Abs(packagePath)
+	fsSignal, err := watch(ctx, ignorePatterns)
 	if err != nil {
-		return fmt.Errorf("get absolute path of package %s: %w", packagePath, err)
+		return err
 	}
 
-	ignorePatterns := mergeIgnorePatterns(readGitIgnore(), readPulseIgnore(), excludes)
+	readiness := work.ReadinessProbe{
+		TCPAddr:    readyTCP,
+		HTTPURL:    readyHTTP,
+		HTTPStatus: readyStatus,
+		Timeout:    readyTimeout,
+	}
+	if readyLog != "" {
+		readiness.LogPattern, err = regexp.Compile(readyLog)
+		if err != nil {
+			return fmt.Errorf("compile readiness log pattern: %w", err)
+		}
+	}
 
-	ctx, shutdown := signal.NotifyContext(context.Background(), os.Interrupt)
-	defer shutdown()
+	var events work.EventHandler
+	if jsonMode {
+		jsonEvents, err := openJSONEvents(jsonOut)
+		if err != nil {
+			return err
+		}
+		defer jsonEvents.Close()
+		events = jsonEvents.handle
+	}
 
-	fsWatcher, err := watcher.NewFileWatcher(
-		watcher.WithIgnorePatterns(ignorePatterns),
-		watcher.WithLogger(slog.Default()),
-	)
+	var control *controlServer
+	if ctlAddr != "" {
+		names := make([]string, 0, len(specs))
+		for _, spec := range specs {
+			names = append(names, spec.name)
+		}
+		control = newControlServer(names)
+		events = combineEvents(events, control.handle)
+	}
+
+	mode, err := work.ParseRestartMode(restartMode)
 	if err != nil {
 		return err
 	}
-	fsSignal := fsWatcher.Listen(ctx)
 
-	outBinPath := genOutBinPath(packagePath)
-	defer os.Remove(outBinPath)
-	slog.DebugContext(ctx, "Generated output binary path", slog.String("path", outBinPath))
+	for _, envFile := range allEnvFiles {
+		if !isWithinDirs(envFile, watchDirs) {
+			log.Printf("[Pulse] env file %s is outside the watched directories, edits won't restart the process\n", envFile)
+		}
+	}
 
-	var runArgs []string
-	if i := slices.Index(args, "--"); i >= 0 {
-		runArgs = args[i+1:]
+	if debugMode {
+		if _, err := exec.LookPath("dlv"); err != nil {
+			return fmt.Errorf("debug mode requires dlv, install it with go install github.com/go-delve/delve/cmd/dlv@latest: %w", err)
+		}
 	}
 
-	if len(watchDirs) == 0 {
-		watchDirs = append(watchDirs, ".")
+	if liveReload && proxyAddr == "" {
+		return fmt.Errorf("live reload requires the proxy to be enabled with -proxy")
 	}
-	for _, watchDir := range watchDirs {
-		fi, err := os.Stat(watchDir)
+
+	var appProxy *proxy.Proxy
+	if proxyAddr != "" {
+		proxyOptions := []proxy.Option{proxy.WithLogger(slog.Default())}
+		if liveReload {
+			proxyOptions = append(proxyOptions, proxy.WithLiveReload())
+		}
+		appProxy, err = proxy.New(proxyTarget, proxyOptions...)
 		if err != nil {
-			return fmt.Errorf("stat watch path %s: %w", watchDir, err)
+			return err
 		}
-		if !fi.IsDir() {
-			return fmt.Errorf("watch path %s is not a directory", watchDir)
+		if !readiness.Enabled() {
+			// Without an explicit probe, wait for the target port before releasing requests
+			readiness.TCPAddr = appProxy.TargetAddr()
 		}
 
-		err = fsWatcher.AddDirectory(ctx, watchDir)
+		go func() {
+			if err := appProxy.ListenAndServe(ctx, proxyAddr); err != nil {
+				log.Printf("[Pulse] proxy stopped: %v\n", err)
+			}
+		}()
+		log.Printf("[Pulse] Proxy listening on %s, forwarding to %s\n", proxyAddr, proxyTarget)
+	}
+
+	var controls <-chan controlAction
+	if control != nil {
+		controls = control.actions
+		l, err := listenControl(ctlAddr)
+		if err != nil {
+			return fmt.Errorf("listen for control API: %w", err)
+		}
+		// Closing removes the socket file
+		defer l.Close()
+		go func() {
+			if err := control.Serve(ctx, l); err != nil {
+				log.Printf("[Pulse] control API stopped: %v\n", err)
+			}
+		}()
+		log.Printf("[Pulse] Control API listening on %s\n", ctlAddr)
+	}
+
+	// With several targets the prebuild command runs once per cycle rather
+	// than once per builder
+	sharedPrebuild := len(specs) > 1 && prebuildCmd != ""
+
+	// The processes run in their own process group and don't see the terminal's
+	// interrupt, so wait for the runners to stop them before exiting
+	runnerCtx, stopRunners := context.WithCancel(ctx)
+	var runners sync.WaitGroup
+	defer func() {
+		stopRunners()
+		runners.Wait()
+		if coverage != nil {
+			logCoverage(coverage)
+		}
+	}()
+
+	var binCache *work.BinaryCache
+	if cacheSize > 0 {
+		binCache, err = work.NewBinaryCache(filepath.Join(os.TempDir(), "pulse", "cache"), int64(cacheSize)<<20)
 		if err != nil {
 			return err
 		}
 	}
 
-	// Create runner and builder
-	runner := work.NewRunner(workingDir, outBinPath, runArgs)
-	go runner.Listen(ctx)
+	var deps *work.DepGraph
+	if depGraph {
+		deps = work.NewDepGraph()
+	}
+
+	sessionTargets := make([]*target, 0, len(specs))
+	for i, spec := range specs {
+		packagePath, err := filepath.Abs(spec.packagePath)
+		if err != nil {
+			return fmt.Errorf("get absolute path of package %s: %w", spec.packagePath, err)
+		}
+		spec.packagePath = packagePath
+
+		outBinPath := targetBinPath(spec)
+		defer os.Remove(outBinPath)
+		slog.DebugContext(ctx, "Generated output binary path", slog.String("target", spec.name), slog.String("path", outBinPath))
+
+		t := &target{
+			name:   spec.name,
+			logger: targetLogger(spec.name),
+			planner: planner{
+				rules:       rules,
+				generators:  generators,
+				envFiles:    spec.envFiles,
+				deps:        deps,
+				packagePath: spec.packagePath,
+			},
+		}
+		output := targetOutput(spec.name)
+		events := targetEvents(spec.name, events)
+		sig, err := work.ParseSignal(spec.stopSignal)
+		if err != nil {
+			return err
+		}
+
+		runnerOptions := []work.RunnerOption{
+			work.WithEnvFiles(spec.envFiles),
+			work.WithRestartPolicy(work.RestartPolicy{
+				Mode:       mode,
+				MaxRetries: restartMax,
+				Backoff:    restartDelay,
+			}),
+			work.WithEnv(spec.env),
+			work.WithStopSignal(sig),
+			work.WithStopTimeout(spec.stopTimeout),
+			work.WithShutdownCommand(spec.shutdownCmd),
+			work.WithProcessOutput(output),
+			work.WithProcessEvents(events),
+			work.WithProcessLogger(t.logger),
+		}
+		// The proxy, readiness probe and forwarded stdin belong to the first target
+		if i == 0 {
+			if noTTY {
+				runnerOptions = append(runnerOptions, work.WithStdin(os.Stdin))
+			}
+			if appProxy != nil {
+				t.proxy = appProxy
+				runnerOptions = append(runnerOptions, work.WithOnReady(func(error) {
+					appProxy.Release()
+				}))
+			}
+			runnerOptions = append(runnerOptions, work.WithReadiness(readiness))
+		}
+		if coverage != nil {
+			runnerOptions = append(runnerOptions, work.WithCoverage(coverage))
+		}
+		if debugMode {
+			addr, err := work.DebugAddr(debugAddr, i)
+			if err != nil {
+				return err
+			}
+			runnerOptions = append(runnerOptions, work.WithDebugger(addr))
+		}
+		t.runner = work.NewRunner(spec.workingDir, outBinPath, spec.runArgs, runnerOptions...)
+
+		builderOptions := []work.BuilderOption{
+			work.WithBuildOutput(output),
+			work.WithBuildEvents(events),
+			work.WithBuildLogger(t.logger),
+		}
+		if keepRunning {
+			builderOptions = append(builderOptions, work.WithStaging())
+		}
+		if debugMode {
+			builderOptions = append(builderOptions, work.WithDebugBuild())
+		}
+		if coverage != nil {
+			builderOptions = append(builderOptions, work.WithCoverageBuild())
+		}
+		if binCache != nil {
+			builderOptions = append(builderOptions, work.WithBinaryCache(binCache))
+		}
+		targetPrebuildCmd := prebuildCmd
+		if sharedPrebuild {
+			targetPrebuildCmd = ""
+		}
+		if deps != nil {
+			deps.AddRoot(spec.packagePath, spec.buildArgs)
+		}
+		t.builder = work.NewBuilder(spec.packagePath, outBinPath, spec.buildArgs, targetPrebuildCmd, builderOptions...)
+
+		runners.Add(1)
+		go func() {
+			defer runners.Done()
+			t.runner.Listen(runnerCtx)
+		}()
+		sessionTargets = append(sessionTargets, t)
+	}
+
+	if deps != nil {
+		// Until the graph is loaded every change affects every target
+		go func() {
+			if err := deps.Load(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("[Pulse] failed to load the dependency graph, rebuilding on every change: %v\n", err)
+			}
+		}()
+	}
+
+	stopAll := func() {
+		for _, t := range sessionTargets {
+			t.runner.Stop()
+		}
+	}
+
+	// startCycle cancels the cycle in flight and starts one doing the work of
+	// plans, one per target
+	var (
+		cycleCtx, cancelCycle = context.WithCancel(ctx)
+		cycleDone             = make(chan struct{})
+		inFlight              []plan
+		inFlightCommands      []string
+		// inFlightRan counts the commands of the cycle in flight that completed
+		inFlightRan = new(atomic.Int32)
+	)
+	close(cycleDone)
+	startCycle := func(plans []plan) {
+		select {
+		case <-cycleDone:
+		default:
+			// Cancelling the cycle in flight must not lose its work, but the
+			// commands it already ran don't run again
+			ran := inFlightCommands[:inFlightRan.Load()]
+			for i := range plans {
+				pending := inFlight[i]
+				pending.commands = slices.DeleteFunc(slices.Clone(pending.commands), func(c string) bool {
+					return slices.Contains(ran, c)
+				})
+				plans[i] = plans[i].merge(pending)
+			}
+		}
+
+		var commands []string
+		for i, t := range sessionTargets {
+			plans[i] = plans[i].forTarget(t.lastBuildOK.Load())
+			if plans[i].action == actionRebuild && !keepRunning {
+				t.runner.Stop()
+				t.hold()
+			}
+			commands = plan{commands: commands}.merge(plans[i]).commands
+		}
+		if sharedPrebuild && slices.ContainsFunc(plans, func(p plan) bool { return p.action == actionRebuild }) {
+			commands = append(commands, prebuildCmd)
+		}
+		cancelCycle()
+
+		inFlight, inFlightCommands, inFlightRan = plans, commands, new(atomic.Int32)
+		cycleCtx, cancelCycle = context.WithCancel(ctx)
+		cycleDone = make(chan struct{})
+		go func(cycleCtx context.Context, cycleDone chan struct{}, plans []plan, commands []string, ran *atomic.Int32) {
+			defer close(cycleDone)
+
+			if err := runRuleCommands(cycleCtx, commands, events, ran); err != nil {
+				if cycleCtx.Err() == nil {
+					log.Printf("[Pulse] %v\n", err)
+				}
+				return
+			}
+
+			var wg sync.WaitGroup
+			for i, t := range sessionTargets {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					t.apply(cycleCtx, plans[i].action)
+				}()
+			}
+			wg.Wait()
+		}(cycleCtx, cycleDone, plans, commands, inFlightRan)
+	}
+	planAll := func(action ruleAction) []plan {
+		plans := make([]plan, len(sessionTargets))
+		for i := range plans {
+			plans[i].action = action
+		}
+		return plans
+	}
+
+	handleChangeSet := func(changeSet watcher.ChangeSet) {
+		if deps != nil && !changeSet.Initial && deps.Invalidate(changeSet.Paths()) {
+			// Like the initial load, the reload runs go list and must not
+			// block the loop, meanwhile every change affects every target
+			go func() {
+				if err := deps.Load(ctx); err != nil {
+					if ctx.Err() == nil {
+						log.Printf("[Pulse] failed to reload the dependency graph: %v\n", err)
+					}
+					return
+				}
+				slog.DebugContext(ctx, "Reloaded dependency graph")
+			}()
+		}
+
+		plans := make([]plan, len(sessionTargets))
+		var overall plan
+		for i, t := range sessionTargets {
+			plans[i] = t.planner.plan(changeSet)
+			overall = overall.merge(plans[i])
+		}
 
-	builder := work.NewBuilder(packagePath, outBinPath, buildArgs, prebuildCmd)
+		if !changeSet.Initial {
+			slog.DebugContext(ctx, "Change set received", slog.Any("paths", changeSet.Paths()), slog.String("action", overall.action.String()))
+			if overall.action == actionIgnore && len(overall.commands) == 0 {
+				return
+			}
+			events.Emit(work.Event{Type: work.EventChange, Paths: changeSet.Paths()})
+
+			switch overall.action {
+			case actionRebuild:
+				log.Printf("[Pulse] Rebuilding because %s changed\n", changeSet)
+			case actionRestart:
+				log.Printf("[Pulse] Restarting because %s changed\n", changeSet)
+			}
+		}
+		startCycle(plans)
+	}
+
+	keys, restoreTerminal := listenKeys()
+	defer restoreTerminal()
+
+	var pause pauseState
+	setPaused := func(paused bool) {
+		changed, missed := pause.set(paused)
+		if !changed {
+			return
+		}
+		if control != nil {
+			control.setPaused(paused)
+		}
+		if paused {
+			log.Println("[Pulse] Paused, changes are ignored until resumed")
+			return
+		}
+		log.Println("[Pulse] Resumed")
+		if len(missed.Changes) > 0 {
+			handleChangeSet(missed)
+		}
+	}
 
 	// Main loop to handle file system events and build process
-	buildCtx, cancelBuild := context.WithCancel(ctx)
 	for {
 		select {
 		case <-ctx.Done():
-			runner.Stop()
-			cancelBuild()
+			stopAll()
+			cancelCycle()
 			return nil
-		case _, ok := <-fsSignal:
-			runner.Stop()
-			cancelBuild()
-
+		case key := <-keys:
+			switch keyActionOf(key) {
+			case keyRebuild:
+				log.Println("[Pulse] Rebuilding")
+				startCycle(planAll(actionRebuild))
+			case keyRestart:
+				log.Println("[Pulse] Restarting")
+				startCycle(planAll(actionRestart))
+			case keyPause:
+				setPaused(!pause.paused)
+			case keyClear:
+				clearScreen()
+			case keyDebugLogs:
+				toggleDebugLogs()
+			case keyQuit:
+				stopAll()
+				cancelCycle()
+				return nil
+			}
+		case action := <-controls:
+			switch action {
+			case controlRebuild:
+				log.Println("[Pulse] Rebuilding")
+				startCycle(planAll(actionRebuild))
+			case controlRestart:
+				log.Println("[Pulse] Restarting")
+				startCycle(planAll(actionRestart))
+			case controlPause:
+				setPaused(true)
+			case controlResume:
+				setPaused(false)
+			}
+		case changeSet, ok := <-fsSignal:
 			if !ok {
 				// Channel closed, watcher stopped
+				stopAll()
+				cancelCycle()
 				return nil
 			}
+			if pause.hold(changeSet) {
+				continue
+			}
+			handleChangeSet(changeSet)
+		}
+	}
+}
 
-			buildCtx, cancelBuild = context.WithCancel(ctx)
-			go func() {
-				err := builder.Build(buildCtx)
-				if err == nil {
-					runner.Refresh()
-				}
-			}()
+// setupLogging configures slog with the level in the LOG_LEVEL environment variable
+func setupLogging() error {
+	s := os.Getenv("LOG_LEVEL")
+	if s == "" {
+		return nil
+	}
+
+	err := baseLogLevel.UnmarshalText([]byte(s))
+	if err != nil {
+		return err
+	}
+	logLevel.Set(baseLogLevel)
+
+	handler := slog.NewTextHandler(pulseOutput(), &slog.HandlerOptions{
+		Level: &logLevel,
+	})
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+// watch starts watching the watch directories and returns the change sets
+func watch(ctx context.Context, ignorePatterns []string) (<-chan watcher.ChangeSet, error) {
+	watcherOptions := []watcher.FileWatcherOption{
+		watcher.WithIgnorePatterns(ignorePatterns),
+		watcher.WithLogger(slog.Default()),
+	}
+	if pollInterval > 0 {
+		watcherOptions = append(watcherOptions, watcher.WithPolling(pollInterval, pollHash))
+	}
+
+	fsWatcher, err := watcher.NewFileWatcher(watcherOptions...)
+	if err != nil {
+		return nil, err
+	}
+	fsSignal := fsWatcher.Listen(ctx)
+
+	if len(watchDirs) == 0 {
+		watchDirs = append(watchDirs, ".")
+	}
+	for _, watchDir := range watchDirs {
+		fi, err := os.Stat(watchDir)
+		if err != nil {
+			return nil, fmt.Errorf("stat watch path %s: %w", watchDir, err)
+		}
+		if !fi.IsDir() {
+			return nil, fmt.Errorf("watch path %s is not a directory", watchDir)
+		}
+
+		err = fsWatcher.AddDirectory(ctx, watchDir)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return fsSignal, nil
+}
+
+// envFileExceptions returns ignore patterns that keep env files within the
+// current directory watched even if they are gitignored
+func envFileExceptions(paths []string) []string {
+	var patterns []string
+	for _, path := range paths {
+		rel := relPath(path)
+		if filepath.IsAbs(rel) || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		patterns = append(patterns, "!"+rel)
+	}
+	return patterns
+}
+
+// outputPatterns returns ignore patterns for the files pulse writes within
+// the current directory: the control socket and the coverage reports
+func outputPatterns() []string {
+	var paths []string
+	if ctlAddr != "" && !isTCPAddr(ctlAddr) {
+		paths = append(paths, ctlAddr)
+	}
+	if coverDir != "" {
+		paths = append(paths, coverDir)
+	}
+	if coverHTML != "" {
+		paths = append(paths, coverHTML)
+	}
+
+	var patterns []string
+	for _, path := range paths {
+		rel := relPath(path)
+		if filepath.IsAbs(rel) || strings.HasPrefix(rel, "..") {
+			continue
 		}
+		patterns = append(patterns, filepath.ToSlash(rel))
+	}
+	return patterns
+}
+
+// logCoverage logs the merged coverage of the session and where the reports are
+func logCoverage(coverage *work.Coverage) {
+	percent, err := coverage.Percent(context.Background())
+	if err != nil {
+		log.Printf("[Pulse] failed to read coverage: %v\n", err)
+		return
+	}
+	if percent == "" {
+		log.Println("[Pulse] No coverage was recorded, the executable has to exit normally to write it")
+		return
+	}
+	for _, line := range strings.Split(percent, "\n") {
+		log.Printf("[Pulse] %s\n", line)
+	}
+	log.Printf("[Pulse] Coverage profile written to %s\n", coverage.ProfilePath())
+	if coverage.HTMLPath() != "" {
+		log.Printf("[Pulse] Coverage report written to %s\n", coverage.HTMLPath())
+	}
+}
+
+// samePath reports whether a and b refer to the same path once made absolute
+func samePath(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}
+
+// isWithinDirs reports whether path is inside any of dirs
+func isWithinDirs(path string, dirs []string) bool {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+
+	for _, dir := range dirs {
+		dirAbs, err := filepath.Abs(dir)
+		if err != nil {
+			continue
+		}
+		rel, err := filepath.Rel(dirAbs, abs)
+		if err == nil && !strings.HasPrefix(rel, "..") {
+			return true
+		}
+	}
+	return false
+}
+
+// pulseOutput returns where build and process output goes. When JSON events are
+// written to stdout, everything else moves to stderr to keep the stream parseable.
+func pulseOutput() io.Writer {
+	if jsonMode && (jsonOut == "" || jsonOut == "-") {
+		return os.Stderr
 	}
+	return os.Stdout
 }
 
 func genOutBinPath(packagePath string) string {
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/panotza/pulse/proxy"
+	"github.com/panotza/pulse/work"
+)
+
+// targetSpec describes a package that is built and run. A session without
+// named targets has a single unnamed one.
+type targetSpec struct {
+	name        string
+	packagePath string
+	buildArgs   []string
+	runArgs     []string
+	env         []string
+	envFiles    []string
+	workingDir  string
+	stopSignal  string
+	stopTimeout time.Duration
+	shutdownCmd string
+}
+
+type targetFlag []targetSpec
+
+func (f *targetFlag) String() string { return "" }
+
+// Set parses NAME=PACKAGE
+func (f *targetFlag) Set(v string) error {
+	name, packagePath, ok := strings.Cut(v, "=")
+	if !ok || name == "" || packagePath == "" {
+		return fmt.Errorf("expected NAME=PACKAGE, got %q", v)
+	}
+	*f = append(*f, targetSpec{name: name, packagePath: packagePath})
+	return nil
+}
+
+// resolveTargets returns the targets of the session with the global options
+// filled in. Without named targets, the package and run arguments come from args.
+func resolveTargets(args []string) ([]targetSpec, error) {
+	if len(targets) == 0 {
+		spec := targetSpec{
+			packagePath: ".",
+			buildArgs:   buildArgs,
+			env:         envVars,
+			envFiles:    envFiles,
+			workingDir:  workingDir,
+			stopSignal:  stopSignal,
+			stopTimeout: stopTimeout,
+			shutdownCmd: shutdownCmd,
+		}
+		if len(args) > 0 && args[0] != "--" {
+			spec.packagePath = args[0]
+			args = args[1:]
+		}
+		if i := slices.Index(args, "--"); i >= 0 {
+			spec.runArgs = args[i+1:]
+		}
+		if spec.stopTimeout <= 0 {
+			return nil, fmt.Errorf("stop timeout must be positive, got %s", spec.stopTimeout)
+		}
+		return []targetSpec{spec}, nil
+	}
+
+	if len(args) > 0 {
+		return nil, errors.New("package and run arguments can't be combined with targets, set them per target instead")
+	}
+
+	specs := make([]targetSpec, 0, len(targets))
+	seen := make(map[string]bool)
+	for _, t := range targets {
+		if seen[t.name] {
+			return nil, fmt.Errorf("duplicate target %q", t.name)
+		}
+		seen[t.name] = true
+
+		if t.buildArgs == nil {
+			t.buildArgs = buildArgs
+		}
+		if t.workingDir == "" {
+			t.workingDir = workingDir
+		}
+		if t.stopSignal == "" {
+			t.stopSignal = stopSignal
+		}
+		if t.stopTimeout == 0 {
+			t.stopTimeout = stopTimeout
+		}
+		if t.stopTimeout <= 0 {
+			return nil, fmt.Errorf("stop timeout of target %q must be positive, got %s", t.name, t.stopTimeout)
+		}
+		if t.shutdownCmd == "" {
+			t.shutdownCmd = shutdownCmd
+		}
+		t.env = append(slices.Clone(envVars), t.env...)
+		t.envFiles = append(slices.Clone(envFiles), t.envFiles...)
+		specs = append(specs, t)
+	}
+	return specs, nil
+}
+
+// target is a package being built and run in the session
+type target struct {
+	name    string
+	builder *work.Builder
+	runner  *work.Runner
+	planner planner
+	proxy   *proxy.Proxy
+	logger  *log.Logger
+
+	// lastBuildOK tells whether the binary on disk matches the sources, a
+	// restart alone would run stale code otherwise
+	lastBuildOK atomic.Bool
+}
+
+// apply restarts or rebuilds the target as the action requires
+func (t *target) apply(ctx context.Context, action ruleAction) {
+	switch action {
+	case actionRestart:
+		t.hold()
+		t.runner.Refresh()
+		return
+	case actionRebuild:
+	default:
+		return
+	}
+
+	result, err := t.builder.Build(ctx)
+	if err == nil {
+		t.lastBuildOK.Store(true)
+		t.hold()
+		t.runner.Refresh()
+		return
+	}
+	if ctx.Err() != nil {
+		return
+	}
+	t.lastBuildOK.Store(false)
+	t.logger.Printf("[Pulse] %v\n", err)
+	if keepRunning {
+		t.logger.Println("[Pulse] Keeping previous process running")
+	}
+
+	if t.proxy != nil {
+		if result.Output != "" {
+			// Show the full compiler output rather than just the summary
+			err = errors.New(strings.TrimSpace(result.Output))
+		}
+		if keepRunning {
+			t.proxy.ShowError(err)
+		} else {
+			t.proxy.Fail(err)
+		}
+	}
+}
+
+// hold makes the proxy, if the target has one, hold requests until the
+// process is ready again
+func (t *target) hold() {
+	if t.proxy != nil {
+		t.proxy.Hold()
+	}
+}
+
+// targetLogger returns the logger for a target, prefixing messages of named
+// targets with their name
+func targetLogger(name string) *log.Logger {
+	if name == "" {
+		return log.Default()
+	}
+	return log.New(log.Writer(), "["+name+"] ", log.Flags()|log.Lmsgprefix)
+}
+
+// targetOutput returns where the build and process output of a target goes,
+// prefixing every line of named targets with their name
+func targetOutput(name string) io.Writer {
+	if name == "" {
+		return pulseOutput()
+	}
+	return &prefixWriter{w: pulseOutput(), prefix: []byte("[" + name + "] ")}
+}
+
+// targetEvents returns an event handler stamping events with the target name
+func targetEvents(name string, events work.EventHandler) work.EventHandler {
+	if name == "" || events == nil {
+		return events
+	}
+	return func(e work.Event) {
+		e.Target = name
+		events(e)
+	}
+}
+
+// targetBinPath returns the output binary path of a target
+func targetBinPath(spec targetSpec) string {
+	if spec.name == "" {
+		return genOutBinPath(spec.packagePath)
+	}
+	return genOutBinPath(filepath.Join(spec.packagePath, spec.name))
+}
+
+// prefixWriter prefixes every line written to w. Lines are written whole so
+// output of several targets doesn't interleave mid-line.
+type prefixWriter struct {
+	mu     sync.Mutex
+	w      io.Writer
+	prefix []byte
+	buf    []byte
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.buf = append(p.buf, b...)
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+		if i < 0 {
+			break
+		}
+		line := append(slices.Clone(p.prefix), p.buf[:i+1]...)
+		p.buf = p.buf[i+1:]
+		if _, err := p.w.Write(line); err != nil {
+			return len(b), err
+		}
+	}
+	return len(b), nil
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestPrefixWriter(t *testing.T) {
+	var out bytes.Buffer
+	w := &prefixWriter{w: &out, prefix: []byte("[api] ")}
+
+	for _, s := range []string{"hel", "lo\nwor", "ld\n", "\n", "partial"} {
+		if n, err := w.Write([]byte(s)); n != len(s) || err != nil {
+			t.Fatalf("Write(%q) = %d, %v", s, n, err)
+		}
+	}
+
+	// The unterminated line is held back until it is complete
+	if want := "[api] hello\n[api] world\n[api] \n"; out.String() != want {
+		t.Errorf("output = %q, want %q", out.String(), want)
+	}
+}
+
+// setTargetGlobals sets the options resolveTargets reads and restores them after the test
+func setTargetGlobals(t *testing.T, specs []targetSpec) {
+	t.Helper()
+	oldTargets, oldBuildArgs, oldEnvVars, oldEnvFiles, oldWorkingDir := targets, buildArgs, envVars, envFiles, workingDir
+	oldStopSignal, oldStopTimeout, oldShutdownCmd := stopSignal, stopTimeout, shutdownCmd
+	t.Cleanup(func() {
+		targets, buildArgs, envVars, envFiles, workingDir = oldTargets, oldBuildArgs, oldEnvVars, oldEnvFiles, oldWorkingDir
+		stopSignal, stopTimeout, shutdownCmd = oldStopSignal, oldStopTimeout, oldShutdownCmd
+	})
+
+	targets = specs
+	buildArgs = []string{"-race"}
+	envVars = []string{"A=global"}
+	envFiles = []string{".env"}
+	workingDir = "."
+	stopSignal = "SIGINT"
+	stopTimeout = 3 * time.Second
+	shutdownCmd = ""
+}
+
+func TestResolveTargets_Single(t *testing.T) {
+	setTargetGlobals(t, nil)
+
+	tests := []struct {
+		args        []string
+		wantPackage string
+		wantRunArgs []string
+	}{
+		{nil, ".", nil},
+		{[]string{"./cmd/app"}, "./cmd/app", nil},
+		{[]string{"./cmd/app", "--", "-port", "8080"}, "./cmd/app", []string{"-port", "8080"}},
+		{[]string{"--", "-port", "8080"}, ".", []string{"-port", "8080"}},
+	}
+
+	for _, tt := range tests {
+		specs, err := resolveTargets(tt.args)
+		if err != nil {
+			t.Fatalf("resolveTargets(%q) error = %v", tt.args, err)
+		}
+		if len(specs) != 1 {
+			t.Fatalf("resolveTargets(%q) returned %d targets, want 1", tt.args, len(specs))
+		}
+		s := specs[0]
+		if s.name != "" || s.packagePath != tt.wantPackage || !slices.Equal(s.runArgs, tt.wantRunArgs) {
+			t.Errorf("resolveTargets(%q) = %q %s %q, want unnamed %s %q", tt.args, s.name, s.packagePath, s.runArgs, tt.wantPackage, tt.wantRunArgs)
+		}
+		if !slices.Equal(s.buildArgs, buildArgs) || !slices.Equal(s.env, envVars) || !slices.Equal(s.envFiles, envFiles) {
+			t.Errorf("resolveTargets(%q) didn't take the global options: %+v", tt.args, s)
+		}
+	}
+}
+
+func TestResolveTargets_Named(t *testing.T) {
+	setTargetGlobals(t, []targetSpec{
+		{name: "api", packagePath: "./cmd/api"},
+		{name: "worker", packagePath: "./cmd/worker", buildArgs: []string{"-tags=worker"}, env: []string{"A=worker"}, envFiles: []string{".env.worker"}, workingDir: "worker"},
+	})
+
+	specs, err := resolveTargets(nil)
+	if err != nil {
+		t.Fatalf("resolveTargets() error = %v", err)
+	}
+	if len(specs) != 2 {
+		t.Fatalf("resolveTargets() returned %d targets, want 2", len(specs))
+	}
+
+	api, worker := specs[0], specs[1]
+	if api.name != "api" || !slices.Equal(api.buildArgs, []string{"-race"}) || api.workingDir != "." {
+		t.Errorf("api = %+v, want the global build arguments and working directory", api)
+	}
+	if !slices.Equal(worker.buildArgs, []string{"-tags=worker"}) || worker.workingDir != "worker" {
+		t.Errorf("worker = %+v, want its own build arguments and working directory", worker)
+	}
+	// Target values come after the global ones so they win
+	if want := []string{"A=global", "A=worker"}; !slices.Equal(worker.env, want) {
+		t.Errorf("worker env = %q, want %q", worker.env, want)
+	}
+	if want := []string{".env", ".env.worker"}; !slices.Equal(worker.envFiles, want) {
+		t.Errorf("worker envFiles = %q, want %q", worker.envFiles, want)
+	}
+
+	if _, err := resolveTargets([]string{"./cmd/api"}); err == nil {
+		t.Error("resolveTargets() with targets and a package succeeded")
+	}
+
+	setTargetGlobals(t, []targetSpec{{name: "api", packagePath: "./cmd/api"}, {name: "api", packagePath: "./cmd/other"}})
+	if _, err := resolveTargets(nil); err == nil {
+		t.Error("resolveTargets() with duplicate names succeeded")
+	}
+}
+
+func TestResolveTargets_Stop(t *testing.T) {
+	setTargetGlobals(t, []targetSpec{
+		{name: "api", packagePath: "./cmd/api"},
+		{name: "worker", packagePath: "./cmd/worker", stopSignal: "SIGTERM", stopTimeout: 30 * time.Second, shutdownCmd: "./drain.sh"},
+	})
+
+	specs, err := resolveTargets(nil)
+	if err != nil {
+		t.Fatalf("resolveTargets() error = %v", err)
+	}
+	api, worker := specs[0], specs[1]
+	if api.stopSignal != "SIGINT" || api.stopTimeout != 3*time.Second || api.shutdownCmd != "" {
+		t.Errorf("api = %+v, want the global stop settings", api)
+	}
+	if worker.stopSignal != "SIGTERM" || worker.stopTimeout != 30*time.Second || worker.shutdownCmd != "./drain.sh" {
+		t.Errorf("worker = %+v, want its own stop settings", worker)
+	}
+
+	targets[1].stopTimeout = -time.Second
+	if _, err := resolveTargets(nil); err == nil {
+		t.Error("resolveTargets() with a negative target stop timeout succeeded")
+	}
+
+	for _, timeout := range []time.Duration{0, -time.Second} {
+		setTargetGlobals(t, nil)
+		stopTimeout = timeout
+		if _, err := resolveTargets(nil); err == nil {
+			t.Errorf("resolveTargets() with a stop timeout of %s succeeded", timeout)
+		}
+	}
+}
+
+func TestTargetFlag(t *testing.T) {
+	var f targetFlag
+	if err := f.Set("api=./cmd/api"); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	if len(f) != 1 || f[0].name != "api" || f[0].packagePath != "./cmd/api" {
+		t.Errorf("Set() = %+v", f)
+	}
+	for _, v := range []string{"api", "=./cmd/api", "api="} {
+		if err := f.Set(v); err == nil {
+			t.Errorf("Set(%q) succeeded", v)
+		}
+	}
+}
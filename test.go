@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"log"
+	"log/slog"
+	"os"
+	"os/signal"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/panotza/pulse/work"
+)
+
+// runTest watches for changes and runs the tests of the packages matching the
+// patterns in args that are affected by each change. Arguments after -- are
+// passed to go test.
+func runTest(args []string) error {
+	err := setupLogging()
+	if err != nil {
+		return err
+	}
+
+	patterns, testArgs := args, []string(nil)
+	if i := slices.Index(args, "--"); i >= 0 {
+		patterns, testArgs = args[:i], args[i+1:]
+	}
+	if len(patterns) == 0 {
+		patterns = []string{"./..."}
+	}
+
+	ctx, shutdown := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer shutdown()
+
+	ignorePatterns := mergeIgnorePatterns(defaultIgnores(), readGitIgnore(), readPulseIgnore(), excludes)
+	fsSignal, err := watch(ctx, ignorePatterns)
+	if err != nil {
+		return err
+	}
+
+	tester := work.NewTester(append(slices.Clone(buildArgs), testArgs...), work.WithTestOutput(pulseOutput()))
+
+	var (
+		// failures holds the failing tests of every package that failed last time
+		failures = make(map[string][]string)
+
+		testCtx, cancelTest = context.WithCancel(ctx)
+		testDone            = make(chan struct{})
+		inFlight            []string
+	)
+	close(testDone)
+	for {
+		select {
+		case <-ctx.Done():
+			cancelTest()
+			<-testDone
+			return nil
+		case changeSet, ok := <-fsSignal:
+			if !ok {
+				// Channel closed, watcher stopped
+				cancelTest()
+				<-testDone
+				return nil
+			}
+
+			packages := patterns
+			if !changeSet.Initial {
+				affected, err := work.AffectedPackages(ctx, patterns, buildArgs, changeSet.Paths())
+				if err != nil {
+					log.Printf("[Pulse] failed to find affected packages: %v\n", err)
+					continue
+				}
+				slog.DebugContext(ctx, "Change set received", slog.Any("paths", changeSet.Paths()), slog.Any("packages", affected))
+
+				select {
+				case <-testDone:
+				default:
+					// Cancelling the run in flight must not lose its packages
+					for _, p := range inFlight {
+						if !slices.Contains(affected, p) {
+							affected = append(affected, p)
+						}
+					}
+				}
+				if len(affected) == 0 {
+					continue
+				}
+				log.Printf("[Pulse] Testing because %s changed\n", changeSet)
+				packages = affected
+			}
+
+			cancelTest()
+			<-testDone
+
+			run := ""
+			if failedOnly {
+				packages, run = failingTests(packages, failures)
+			}
+
+			inFlight = packages
+			testCtx, cancelTest = context.WithCancel(ctx)
+			testDone = make(chan struct{})
+			go func(testCtx context.Context, testDone chan struct{}, packages []string, run string) {
+				defer close(testDone)
+
+				results, err := tester.Test(testCtx, packages, run)
+				if testCtx.Err() != nil {
+					return
+				}
+				if err != nil {
+					log.Printf("[Pulse] %v\n", err)
+					return
+				}
+				for _, r := range results {
+					if r.Passed {
+						delete(failures, r.Package)
+					} else {
+						failures[r.Package] = r.Failed
+					}
+				}
+				logTestSummary(results)
+			}(testCtx, testDone, packages, run)
+		}
+	}
+}
+
+// failingTests narrows packages down to those with failing tests and returns a
+// -run pattern matching the failing tests. Without known failures among the
+// packages, all of them are tested.
+func failingTests(packages []string, failures map[string][]string) ([]string, string) {
+	var (
+		failing []string
+		tests   []string
+	)
+	for _, p := range packages {
+		failed, ok := failures[p]
+		if !ok {
+			continue
+		}
+		if len(failed) == 0 {
+			// The package failed outside of a test, e.g. to build
+			return packages, ""
+		}
+		failing = append(failing, p)
+		for _, t := range failed {
+			if t = regexp.QuoteMeta(t); !slices.Contains(tests, t) {
+				tests = append(tests, t)
+			}
+		}
+	}
+	if len(failing) == 0 {
+		return packages, ""
+	}
+	return failing, "^(" + strings.Join(tests, "|") + ")$"
+}
+
+// logTestSummary logs the outcome of every tested package
+func logTestSummary(results []work.PackageResult) {
+	var passed, failed, noTests int
+	for _, r := range results {
+		switch {
+		case r.NoTests:
+			noTests++
+		case r.Passed:
+			passed++
+			log.Printf("[Pulse] ok   %s (%s)\n", r.Package, r.Elapsed)
+		default:
+			failed++
+			if len(r.Failed) > 0 {
+				log.Printf("[Pulse] FAIL %s (%s): %s\n", r.Package, r.Elapsed, strings.Join(r.Failed, ", "))
+			} else {
+				log.Printf("[Pulse] FAIL %s (%s)\n", r.Package, r.Elapsed)
+			}
+		}
+	}
+	log.Printf("[Pulse] %d passed, %d failed, %d without tests\n", passed, failed, noTests)
+}
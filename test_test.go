@@ -0,0 +1,69 @@
+package main
+
+import (
+	"regexp"
+	"slices"
+	"testing"
+)
+
+func TestFailingTests(t *testing.T) {
+	packages := []string{"example.com/m/a", "example.com/m/b", "example.com/m/c"}
+
+	tests := []struct {
+		name         string
+		failures     map[string][]string
+		wantPackages []string
+		wantRun      string
+	}{
+		{
+			name:         "NoFailures",
+			wantPackages: packages,
+		},
+		{
+			name:         "FailuresOutsidePackages",
+			failures:     map[string][]string{"example.com/m/other": {"TestA"}},
+			wantPackages: packages,
+		},
+		{
+			name: "FailingTests",
+			failures: map[string][]string{
+				"example.com/m/a": {"TestA", "TestShared"},
+				"example.com/m/c": {"TestShared", "TestC"},
+			},
+			wantPackages: []string{"example.com/m/a", "example.com/m/c"},
+			wantRun:      "^(TestA|TestShared|TestC)$",
+		},
+		{
+			name:         "QuotedNames",
+			failures:     map[string][]string{"example.com/m/b": {"TestA.B"}},
+			wantPackages: []string{"example.com/m/b"},
+			wantRun:      `^(TestA\.B)$`,
+		},
+		{
+			name: "PackageFailure",
+			failures: map[string][]string{
+				"example.com/m/a": {"TestA"},
+				"example.com/m/b": nil,
+			},
+			wantPackages: packages,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotPackages, gotRun := failingTests(packages, tt.failures)
+			if !slices.Equal(gotPackages, tt.wantPackages) || gotRun != tt.wantRun {
+				t.Errorf("failingTests() = %q, %q, want %q, %q", gotPackages, gotRun, tt.wantPackages, tt.wantRun)
+			}
+		})
+	}
+
+	// The pattern is anchored, tests sharing a prefix with a failing one don't run
+	_, run := failingTests(packages, map[string][]string{"example.com/m/a": {"TestA"}})
+	re := regexp.MustCompile(run)
+	for name, want := range map[string]bool{"TestA": true, "TestAB": false, "XTestA": false} {
+		if got := re.MatchString(name); got != want {
+			t.Errorf("pattern %s matches %s = %v, want %v", run, name, got, want)
+		}
+	}
+}
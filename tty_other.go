@@ -0,0 +1,19 @@
+//go:build !(aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris || zos)
+
+package main
+
+import (
+	"golang.org/x/term"
+)
+
+// enableKeys switches the terminal to raw mode to read single key presses.
+// Ctrl+C arrives as a key press then and is handled like q.
+func enableKeys(fd int) (restore func(), err error) {
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return nil, err
+	}
+	return func() {
+		_ = term.Restore(fd, state)
+	}, nil
+}
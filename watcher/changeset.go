@@ -0,0 +1,103 @@
+package watcher
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Change describes a single changed path within a ChangeSet
+type Change struct {
+	// Path is the path of the changed file as reported by the notifier
+	Path string
+	// Op is the union of all fsnotify operations seen for Path in the batch
+	Op fsnotify.Op
+	// Root is the watch root the path was found under, empty if unknown
+	Root string
+}
+
+// ChangeSet is a debounced batch of filesystem changes delivered by a FileNotifier
+type ChangeSet struct {
+	// Initial is true for the synthetic change set emitted when listening starts
+	Initial bool
+	// Time is when the batch was delivered
+	Time time.Time
+	// Changes holds one entry per changed path, in order of first occurrence
+	Changes []Change
+}
+
+// Paths returns the changed paths in the change set
+func (cs ChangeSet) Paths() []string {
+	paths := make([]string, 0, len(cs.Changes))
+	for _, c := range cs.Changes {
+		paths = append(paths, c.Path)
+	}
+	return paths
+}
+
+// String returns a short human readable summary of the change set
+func (cs ChangeSet) String() string {
+	switch len(cs.Changes) {
+	case 0:
+		if cs.Initial {
+			return "initial build"
+		}
+		return "no changes"
+	case 1:
+		return cs.Changes[0].Path
+	default:
+		return fmt.Sprintf("%s and %d more", cs.Changes[0].Path, len(cs.Changes)-1)
+	}
+}
+
+// changeBatch accumulates fsnotify events between debounce fires
+type changeBatch struct {
+	changes []Change
+	index   map[string]int
+}
+
+func (b *changeBatch) add(path string, op fsnotify.Op) {
+	if b.index == nil {
+		b.index = make(map[string]int)
+	}
+	if i, ok := b.index[path]; ok {
+		b.changes[i].Op |= op
+		return
+	}
+	b.index[path] = len(b.changes)
+	b.changes = append(b.changes, Change{Path: path, Op: op})
+}
+
+// flush returns the accumulated changes and resets the batch
+func (b *changeBatch) flush() []Change {
+	changes := b.changes
+	b.changes = nil
+	b.index = nil
+	return changes
+}
+
+// rootOf returns the longest root that contains path, or an empty string if none does
+func rootOf(roots []string, path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return ""
+	}
+
+	var match, matchAbs string
+	for _, root := range roots {
+		rootAbs, err := filepath.Abs(root)
+		if err != nil {
+			continue
+		}
+		if abs != rootAbs && !strings.HasPrefix(abs, strings.TrimSuffix(rootAbs, string(filepath.Separator))+string(filepath.Separator)) {
+			continue
+		}
+		if len(rootAbs) > len(matchAbs) {
+			match, matchAbs = root, rootAbs
+		}
+	}
+	return match
+}
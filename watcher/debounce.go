@@ -11,6 +11,7 @@ type debounce struct {
 	timer    *time.Timer
 	done     bool
 	callback func()
+	running  sync.WaitGroup
 }
 
 func (d *debounce) reset() {
@@ -21,25 +22,28 @@ func (d *debounce) reset() {
 		return
 	}
 
-	if d.timer != nil {
-		d.timer.Stop()
+	if d.timer != nil && d.timer.Stop() {
+		d.running.Done()
 	}
 
+	d.running.Add(1)
 	d.timer = time.AfterFunc(d.after, func() {
+		defer d.running.Done()
 		d.callback()
 	})
 }
 
+// cancel stops a pending invocation and waits for one that is already running
 func (d *debounce) cancel() {
 	d.mu.Lock()
-	defer d.mu.Unlock()
-
-	if d.timer != nil {
-		d.timer.Stop()
-		d.timer = nil
+	if d.timer != nil && d.timer.Stop() {
+		d.running.Done()
 	}
-
+	d.timer = nil
 	d.done = true
+	d.mu.Unlock()
+
+	d.running.Wait()
 }
 
 // newDebounce creates a debounced instance that delays invoking functions given until after wait milliseconds have elapsed.
@@ -0,0 +1,42 @@
+package watcher
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDebounce_CancelWaitsForCallback(t *testing.T) {
+	var finished atomic.Bool
+	started := make(chan struct{})
+	fire, cancel := newDebounce(time.Millisecond, func() {
+		close(started)
+		time.Sleep(50 * time.Millisecond)
+		finished.Store(true)
+	})
+
+	fire()
+	<-started
+	cancel()
+
+	if !finished.Load() {
+		t.Error("cancel() returned while the callback was still running")
+	}
+}
+
+func TestDebounce_CancelStopsPending(t *testing.T) {
+	var calls atomic.Int32
+	fire, cancel := newDebounce(20*time.Millisecond, func() {
+		calls.Add(1)
+	})
+
+	fire()
+	fire()
+	cancel()
+	fire()
+
+	time.Sleep(50 * time.Millisecond)
+	if n := calls.Load(); n != 0 {
+		t.Errorf("callback called %d times after cancel()", n)
+	}
+}
@@ -2,20 +2,36 @@ package watcher
 
 import (
 	"context"
+	"crypto/sha256"
 	"errors"
 	"fmt"
+	"io/fs"
 	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
 	"time"
 
 	"github.com/codeglyph/go-dotignore"
 	"github.com/fsnotify/fsnotify"
 )
 
+// maxHashSize is the size up to which file contents are hashed to tell writes
+// that leave a file as it was apart. Writes to larger files always count.
+const maxHashSize = 8 << 20
+
 // FSNotify watches the filesystem for changes with configurable filters
 type FSNotify struct {
 	*fsnotify.Watcher
 	logger        *slog.Logger
 	ignoreMatcher *dotignore.PatternMatcher
+
+	mu      sync.Mutex
+	pending changeBatch
+	// hashes holds every path known to exist in the watched directories as of
+	// the last delivered change set, with the content hash of regular files
+	hashes map[string]*[sha256.Size]byte
 }
 
 // NewFSNotify creates a new filesystem watcher with specified filters
@@ -29,23 +45,48 @@ func NewFSNotify(logger *slog.Logger, ignoreMatcher *dotignore.PatternMatcher) (
 		Watcher:       watcher,
 		logger:        logger,
 		ignoreMatcher: ignoreMatcher,
+		hashes:        make(map[string]*[sha256.Size]byte),
 	}, nil
 }
 
-func (fsw *FSNotify) Listen(ctx context.Context) <-chan struct{} {
-	signal := make(chan struct{}, 1)
+// Listen starts watching and delivers a ChangeSet for every debounced batch of
+// significant events. An initial, empty ChangeSet is delivered right away.
+func (fsw *FSNotify) Listen(ctx context.Context) <-chan ChangeSet {
+	signal := make(chan ChangeSet, 1)
 
 	go func() {
 		defer fsw.Close()
 		defer close(signal)
 
+		// stop unblocks a flush sending a change set nobody receives anymore
+		stop := make(chan struct{})
 		fire, stopFire := newDebounce(100*time.Millisecond, func() {
-			signal <- struct{}{}
+			fsw.mu.Lock()
+			changes := slices.DeleteFunc(fsw.pending.flush(), func(c Change) bool {
+				if !fsw.unchanged(c) {
+					return false
+				}
+				fsw.logger.DebugContext(ctx, "ignoring change that left the content as it was", slog.String("path", c.Path), slog.String("event", c.Op.String()))
+				return true
+			})
+			fsw.mu.Unlock()
+
+			if len(changes) == 0 {
+				return
+			}
+
+			select {
+			case signal <- ChangeSet{Time: time.Now(), Changes: changes}:
+			case <-ctx.Done():
+			case <-stop:
+			}
 		})
+		// A running flush must finish before signal is closed
 		defer stopFire()
+		defer close(stop)
 
 		// Initial build trigger
-		fire()
+		signal <- ChangeSet{Initial: true, Time: time.Now()}
 
 		for {
 			select {
@@ -66,6 +107,9 @@ func (fsw *FSNotify) Listen(ctx context.Context) <-chan struct{} {
 				}
 
 				if shouldFire {
+					fsw.mu.Lock()
+					fsw.pending.add(event.Name, event.Op)
+					fsw.mu.Unlock()
 					fire()
 				}
 			case err, ok := <-fsw.Errors:
@@ -116,8 +160,62 @@ func (fsw *FSNotify) handleEvent(ctx context.Context, event fsnotify.Event) (boo
 	return false, nil
 }
 
+// unchanged reports whether a change left the path as it was before the batch,
+// such as a formatter rewriting a file with identical bytes or an editor's
+// backup file created and removed again. It records the new state of changed
+// paths. Must be called with fsw.mu held.
+func (fsw *FSNotify) unchanged(c Change) bool {
+	// Event paths of the "." root start with "./"
+	path := filepath.Clean(c.Path)
+	prev, known := fsw.hashes[path]
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		delete(fsw.hashes, path)
+		return !known && errors.Is(err, fs.ErrNotExist)
+	}
+	fsw.hashes[path] = nil
+	if !fi.Mode().IsRegular() || fi.Size() > maxHashSize {
+		return false
+	}
+
+	sum, err := hashFile(path)
+	if err != nil {
+		return false
+	}
+	fsw.hashes[path] = &sum
+	return prev != nil && *prev == sum
+}
+
+// Add watches a directory and records the content hashes of its files
 func (fsw *FSNotify) Add(path string) error {
-	return fsw.Watcher.Add(path)
+	if err := fsw.Watcher.Add(path); err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return err
+	}
+	fsw.mu.Lock()
+	defer fsw.mu.Unlock()
+	for _, e := range entries {
+		name := filepath.Join(path, e.Name())
+		if ignored, err := fsw.ignoreMatcher.Matches(name); err != nil || ignored {
+			continue
+		}
+		fsw.hashes[name] = nil
+		if !e.Type().IsRegular() {
+			continue
+		}
+		if fi, err := e.Info(); err != nil || fi.Size() > maxHashSize {
+			continue
+		}
+		if sum, err := hashFile(name); err == nil {
+			fsw.hashes[name] = &sum
+		}
+	}
+	return nil
 }
 
 // Ensure that FSNotify implements the FileNotifier interface
@@ -0,0 +1,243 @@
+package watcher
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/codeglyph/go-dotignore"
+	"github.com/fsnotify/fsnotify"
+)
+
+// fileState is the snapshot of a file the Poller compares against
+type fileState struct {
+	modTime time.Time
+	size    int64
+	hash    [sha256.Size]byte
+}
+
+// readDir lists a directory, replaced in tests to change the tree mid-scan
+var readDir = os.ReadDir
+
+// Poller watches the filesystem by periodically walking the registered directories.
+// It works on filesystems where inotify and friends do not deliver events, such as
+// bind mounts, network shares and container volume mounts.
+type Poller struct {
+	logger        *slog.Logger
+	ignoreMatcher *dotignore.PatternMatcher
+	interval      time.Duration
+	hashContents  bool
+
+	mu    sync.Mutex
+	dirs  map[string]struct{}
+	files map[string]fileState
+}
+
+// NewPoller creates a new polling watcher. When hashContents is true, files whose
+// mtime or size changed are only reported if their content hash changed as well.
+func NewPoller(logger *slog.Logger, ignoreMatcher *dotignore.PatternMatcher, interval time.Duration, hashContents bool) *Poller {
+	return &Poller{
+		logger:        logger,
+		ignoreMatcher: ignoreMatcher,
+		interval:      interval,
+		hashContents:  hashContents,
+		dirs:          make(map[string]struct{}),
+		files:         make(map[string]fileState),
+	}
+}
+
+// Add registers a directory and records the current state of its files
+func (p *Poller) Add(path string) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("%s is not a directory", path)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.dirs[path] = struct{}{}
+	return p.scanDir(path, nil, nil)
+}
+
+// Listen starts polling and delivers a ChangeSet for every interval in which
+// significant changes were found. An initial, empty ChangeSet is delivered right away.
+func (p *Poller) Listen(ctx context.Context) <-chan ChangeSet {
+	signal := make(chan ChangeSet, 1)
+
+	go func() {
+		defer close(signal)
+
+		// Initial build trigger
+		signal <- ChangeSet{Initial: true, Time: time.Now()}
+
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				changes := p.poll(ctx)
+				if len(changes) == 0 {
+					continue
+				}
+
+				select {
+				case signal <- ChangeSet{Time: time.Now(), Changes: changes}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return signal
+}
+
+// poll scans every registered directory once and returns the detected changes
+func (p *Poller) poll(ctx context.Context) []Change {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var batch changeBatch
+	seen := make(map[string]struct{}, len(p.files))
+
+	dirs := make([]string, 0, len(p.dirs))
+	for dir := range p.dirs {
+		dirs = append(dirs, dir)
+	}
+
+	for _, dir := range dirs {
+		err := p.scanDir(dir, &batch, seen)
+		if errors.Is(err, fs.ErrNotExist) {
+			p.logger.DebugContext(ctx, "poller directory removed", slog.String("path", dir))
+			delete(p.dirs, dir)
+			batch.add(dir, fsnotify.Remove)
+			continue
+		}
+		if err != nil {
+			p.logger.WarnContext(ctx, "poller scan warning", slog.String("path", dir), slog.Any("error", err))
+		}
+	}
+
+	for path := range p.files {
+		if _, ok := seen[path]; !ok {
+			delete(p.files, path)
+			batch.add(path, fsnotify.Remove)
+		}
+	}
+
+	return batch.flush()
+}
+
+// scanDir compares the direct entries of dir with the recorded snapshot, marking
+// every file found in seen. Newly appeared subdirectories are registered and
+// scanned as well. When batch is nil the snapshot is updated without recording
+// any changes. Only an error reading dir itself is returned, a subdirectory
+// that can't be scanned doesn't stop the scan of its siblings.
+func (p *Poller) scanDir(dir string, batch *changeBatch, seen map[string]struct{}) error {
+	entries, err := readDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+
+		ignored, err := p.ignoreMatcher.Matches(path)
+		if err != nil {
+			return err
+		}
+		if ignored {
+			continue
+		}
+
+		if entry.IsDir() {
+			if _, ok := p.dirs[path]; ok {
+				continue
+			}
+			p.dirs[path] = struct{}{}
+			err := p.scanDir(path, batch, seen)
+			if errors.Is(err, fs.ErrNotExist) {
+				// Removed between ReadDir and the scan, e.g. a temporary directory
+				delete(p.dirs, path)
+				continue
+			}
+			if err != nil {
+				p.logger.Warn("poller scan warning", slog.String("path", path), slog.Any("error", err))
+			}
+			if batch != nil {
+				batch.add(path, fsnotify.Create)
+			}
+			continue
+		}
+
+		fi, err := entry.Info()
+		if err != nil {
+			continue // removed between ReadDir and Info
+		}
+		if seen != nil {
+			seen[path] = struct{}{}
+		}
+
+		state := fileState{modTime: fi.ModTime(), size: fi.Size()}
+		prev, ok := p.files[path]
+		if ok && prev.modTime.Equal(state.modTime) && prev.size == state.size {
+			continue
+		}
+
+		if p.hashContents {
+			state.hash, err = hashFile(path)
+			if err != nil {
+				continue
+			}
+		}
+		p.files[path] = state
+
+		if batch == nil {
+			continue
+		}
+		switch {
+		case !ok:
+			batch.add(path, fsnotify.Create)
+		case p.hashContents && prev.hash == state.hash:
+			// Only the metadata changed
+		default:
+			batch.add(path, fsnotify.Write)
+		}
+	}
+	return nil
+}
+
+func hashFile(path string) ([sha256.Size]byte, error) {
+	var sum [sha256.Size]byte
+
+	f, err := os.Open(path)
+	if err != nil {
+		return sum, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return sum, err
+	}
+	copy(sum[:], h.Sum(nil))
+	return sum, nil
+}
+
+// Ensure that Poller implements the FileNotifier interface
+var _ FileNotifier = (*Poller)(nil)
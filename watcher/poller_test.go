@@ -0,0 +1,226 @@
+package watcher
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/codeglyph/go-dotignore"
+	"github.com/fsnotify/fsnotify"
+)
+
+func newTestPoller(t *testing.T, hash bool, patterns ...string) *Poller {
+	t.Helper()
+
+	matcher, err := dotignore.NewPatternMatcher(patterns)
+	if err != nil {
+		t.Fatalf("Failed to create pattern matcher: %v", err)
+	}
+	return NewPoller(slog.New(slog.DiscardHandler), matcher, time.Hour, hash)
+}
+
+func TestPoller_Poll(t *testing.T) {
+	t.Run("DetectsChanges", func(t *testing.T) {
+		tempDir := setupTestDir(t)
+		p := newTestPoller(t, false)
+
+		err := p.Add(tempDir)
+		if err != nil {
+			t.Fatalf("Add failed: %v", err)
+		}
+
+		if changes := p.poll(context.Background()); len(changes) != 0 {
+			t.Fatalf("Expected no changes after Add, got %v", changes)
+		}
+
+		modified := filepath.Join(tempDir, "dir1", "file1.txt")
+		created := filepath.Join(tempDir, "dir2", "new.txt")
+		removed := filepath.Join(tempDir, "dir2", "file3.txt")
+
+		if err := os.WriteFile(modified, []byte("changed"), 0o644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+		if err := os.WriteFile(created, []byte("new"), 0o644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+		if err := os.Remove(removed); err != nil {
+			t.Fatalf("Failed to remove file: %v", err)
+		}
+
+		want := map[string]fsnotify.Op{
+			modified: fsnotify.Write,
+			created:  fsnotify.Create,
+			removed:  fsnotify.Remove,
+		}
+
+		changes := p.poll(context.Background())
+		if len(changes) != len(want) {
+			t.Fatalf("Expected %d changes, got %v", len(want), changes)
+		}
+		for _, c := range changes {
+			if want[c.Path] != c.Op {
+				t.Errorf("Expected %s for %s, got %s", want[c.Path], c.Path, c.Op)
+			}
+		}
+	})
+
+	t.Run("NewDirectory", func(t *testing.T) {
+		tempDir := setupTestDir(t)
+		p := newTestPoller(t, false)
+
+		if err := p.Add(tempDir); err != nil {
+			t.Fatalf("Add failed: %v", err)
+		}
+
+		newDir := filepath.Join(tempDir, "dir3")
+		if err := os.Mkdir(newDir, 0o755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		p.poll(context.Background())
+
+		newFile := filepath.Join(newDir, "file.txt")
+		if err := os.WriteFile(newFile, []byte("new"), 0o644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+
+		changes := p.poll(context.Background())
+		if len(changes) != 1 || changes[0].Path != newFile {
+			t.Errorf("Expected change for %s, got %v", newFile, changes)
+		}
+	})
+
+	t.Run("IgnorePatterns", func(t *testing.T) {
+		tempDir := setupTestDir(t)
+		p := newTestPoller(t, false, "*.log")
+
+		if err := p.Add(tempDir); err != nil {
+			t.Fatalf("Add failed: %v", err)
+		}
+
+		if err := os.WriteFile(filepath.Join(tempDir, "dir1", "debug.log"), []byte("log"), 0o644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+
+		if changes := p.poll(context.Background()); len(changes) != 0 {
+			t.Errorf("Expected ignored file to produce no changes, got %v", changes)
+		}
+	})
+
+	t.Run("HashSkipsTouch", func(t *testing.T) {
+		tempDir := setupTestDir(t)
+		p := newTestPoller(t, true)
+
+		if err := p.Add(tempDir); err != nil {
+			t.Fatalf("Add failed: %v", err)
+		}
+
+		touched := filepath.Join(tempDir, "dir1", "file1.txt")
+		future := time.Now().Add(time.Hour)
+		if err := os.Chtimes(touched, future, future); err != nil {
+			t.Fatalf("Failed to touch file: %v", err)
+		}
+
+		if changes := p.poll(context.Background()); len(changes) != 0 {
+			t.Errorf("Expected touch to produce no changes, got %v", changes)
+		}
+	})
+
+	t.Run("HashSkipsIdenticalRewrite", func(t *testing.T) {
+		tempDir := setupTestDir(t)
+		p := newTestPoller(t, true)
+
+		if err := p.Add(tempDir); err != nil {
+			t.Fatalf("Add failed: %v", err)
+		}
+
+		// A formatter rewriting a file with the same bytes next to a real edit
+		rewritten := filepath.Join(tempDir, "dir1", "file1.txt")
+		edited := filepath.Join(tempDir, "dir2", "file3.txt")
+		content, err := os.ReadFile(rewritten)
+		if err != nil {
+			t.Fatalf("Failed to read file: %v", err)
+		}
+		future := time.Now().Add(time.Hour)
+		for path, data := range map[string][]byte{rewritten: content, edited: []byte("edited")} {
+			if err := os.WriteFile(path, data, 0o644); err != nil {
+				t.Fatalf("Failed to write file: %v", err)
+			}
+			if err := os.Chtimes(path, future, future); err != nil {
+				t.Fatalf("Failed to touch file: %v", err)
+			}
+		}
+
+		changes := p.poll(context.Background())
+		if len(changes) != 1 || changes[0].Path != edited {
+			t.Errorf("Expected only %s to change, got %v", edited, changes)
+		}
+	})
+
+	t.Run("TouchWithoutHash", func(t *testing.T) {
+		tempDir := setupTestDir(t)
+		p := newTestPoller(t, false)
+
+		if err := p.Add(tempDir); err != nil {
+			t.Fatalf("Add failed: %v", err)
+		}
+
+		// Without hashing the mtime is all the poller has to go by
+		touched := filepath.Join(tempDir, "dir1", "file1.txt")
+		future := time.Now().Add(time.Hour)
+		if err := os.Chtimes(touched, future, future); err != nil {
+			t.Fatalf("Failed to touch file: %v", err)
+		}
+
+		changes := p.poll(context.Background())
+		if len(changes) != 1 || changes[0].Path != touched {
+			t.Errorf("Expected change for %s, got %v", touched, changes)
+		}
+	})
+}
+
+func TestPoller_SubdirRemovedMidScan(t *testing.T) {
+	root := t.TempDir()
+	known := filepath.Join(root, "z.txt")
+	if err := os.WriteFile(known, []byte("z"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	p := newTestPoller(t, false)
+	if err := p.Add(root); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+
+	// A tool creates a temporary directory and removes it right after the
+	// poller listed the root
+	tmp := filepath.Join(root, "tmp")
+	if err := os.Mkdir(tmp, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { readDir = os.ReadDir })
+	readDir = func(name string) ([]os.DirEntry, error) {
+		entries, err := os.ReadDir(name)
+		if name == root {
+			os.RemoveAll(tmp)
+		}
+		return entries, err
+	}
+
+	if changes := p.poll(context.Background()); len(changes) != 0 {
+		t.Errorf("Expected no changes, got %v", changes)
+	}
+	if _, ok := p.dirs[root]; !ok {
+		t.Fatal("Expected the root to stay registered")
+	}
+
+	created := filepath.Join(root, "new.txt")
+	if err := os.WriteFile(created, []byte("new"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	changes := p.poll(context.Background())
+	if len(changes) != 1 || changes[0].Path != created || changes[0].Op != fsnotify.Create {
+		t.Errorf("Expected the root to keep being polled, got %v", changes)
+	}
+}
@@ -6,13 +6,16 @@ import (
 	"log/slog"
 	"os"
 	"path/filepath"
+	"sync"
+	"time"
 
 	"github.com/codeglyph/go-dotignore"
 )
 
+// FileNotifier watches individual directories and delivers debounced change sets
 type FileNotifier interface {
 	Add(path string) error
-	Listen(ctx context.Context) <-chan struct{}
+	Listen(ctx context.Context) <-chan ChangeSet
 }
 
 type FileWatcher struct {
@@ -20,6 +23,12 @@ type FileWatcher struct {
 	logger         *slog.Logger
 	notifier       FileNotifier
 	ignoreMatcher  *dotignore.PatternMatcher
+
+	pollInterval time.Duration
+	pollHash     bool
+
+	mu    sync.RWMutex
+	roots []string
 }
 
 // FileWatcherOption defines a function type for configuring FileWatcher
@@ -46,6 +55,16 @@ func WithNotifier(notifier FileNotifier) FileWatcherOption {
 	}
 }
 
+// WithPolling makes the file watcher poll the filesystem at the given interval
+// instead of relying on fsnotify. When hash is true, content hashes are compared
+// in addition to mtime and size.
+func WithPolling(interval time.Duration, hash bool) FileWatcherOption {
+	return func(fw *FileWatcher) {
+		fw.pollInterval = interval
+		fw.pollHash = hash
+	}
+}
+
 // NewFileWatcher creates a new FileWatcher with optional configuration
 func NewFileWatcher(options ...FileWatcherOption) (*FileWatcher, error) {
 	fw := &FileWatcher{
@@ -65,6 +84,9 @@ func NewFileWatcher(options ...FileWatcherOption) (*FileWatcher, error) {
 	}
 	fw.ignoreMatcher = matcher
 
+	if fw.notifier == nil && fw.pollInterval > 0 {
+		fw.notifier = NewPoller(fw.logger, fw.ignoreMatcher, fw.pollInterval, fw.pollHash)
+	}
 	if fw.notifier == nil {
 		fsNotify, err := NewFSNotify(fw.logger, fw.ignoreMatcher)
 		if err != nil {
@@ -80,6 +102,10 @@ func (fw *FileWatcher) isPathIgnored(path string) (bool, error) {
 }
 
 func (fw *FileWatcher) AddDirectory(ctx context.Context, path string) error {
+	fw.mu.Lock()
+	fw.roots = append(fw.roots, path)
+	fw.mu.Unlock()
+
 	// Walk through all subdirectories and add them
 	return filepath.WalkDir(path, func(walkPath string, d os.DirEntry, err error) error {
 		if ctx.Err() != nil {
@@ -117,6 +143,31 @@ func (fw *FileWatcher) AddDirectory(ctx context.Context, path string) error {
 	})
 }
 
-func (fw *FileWatcher) Listen(ctx context.Context) <-chan struct{} {
-	return fw.notifier.Listen(ctx)
+// Listen delivers change sets from the underlying notifier with the originating
+// watch root of every change filled in.
+func (fw *FileWatcher) Listen(ctx context.Context) <-chan ChangeSet {
+	in := fw.notifier.Listen(ctx)
+	out := make(chan ChangeSet, 1)
+
+	go func() {
+		defer close(out)
+
+		for cs := range in {
+			fw.mu.RLock()
+			for i := range cs.Changes {
+				if cs.Changes[i].Root == "" {
+					cs.Changes[i].Root = rootOf(fw.roots, cs.Changes[i].Path)
+				}
+			}
+			fw.mu.RUnlock()
+
+			select {
+			case out <- cs:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out
 }
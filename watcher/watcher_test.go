@@ -29,8 +29,8 @@ func (m *mockFileNotifier) Add(path string) error {
 	return nil
 }
 
-func (m *mockFileNotifier) Listen(ctx context.Context) <-chan struct{} {
-	ch := make(chan struct{})
+func (m *mockFileNotifier) Listen(ctx context.Context) <-chan ChangeSet {
+	ch := make(chan ChangeSet)
 	close(ch)
 	return ch
 }
@@ -409,3 +409,145 @@ func TestFileWatcher_AddDirectory(t *testing.T) {
 		}
 	})
 }
+
+func TestFileWatcher_Listen(t *testing.T) {
+	t.Run("ChangeSet", func(t *testing.T) {
+		tempDir := setupTestDir(t)
+		logger := slog.New(slog.DiscardHandler)
+
+		fw, err := NewFileWatcher(WithLogger(logger))
+		if err != nil {
+			t.Fatalf("Failed to create FileWatcher: %v", err)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		err = fw.AddDirectory(ctx, tempDir)
+		if err != nil {
+			t.Fatalf("AddDirectory failed: %v", err)
+		}
+		signal := fw.Listen(ctx)
+
+		initial := <-signal
+		if !initial.Initial {
+			t.Errorf("Expected initial change set, got %v", initial)
+		}
+
+		changed := filepath.Join(tempDir, "dir1", "file1.txt")
+		for range 3 {
+			err = os.WriteFile(changed, []byte("hello"), 0o644)
+			if err != nil {
+				t.Fatalf("Failed to write file: %v", err)
+			}
+		}
+
+		select {
+		case cs := <-signal:
+			if cs.Initial {
+				t.Errorf("Expected non-initial change set")
+			}
+			if len(cs.Changes) != 1 {
+				t.Fatalf("Expected 1 change, got %d: %v", len(cs.Changes), cs.Paths())
+			}
+			if cs.Changes[0].Path != changed {
+				t.Errorf("Expected path %s, got %s", changed, cs.Changes[0].Path)
+			}
+			if cs.Changes[0].Root != tempDir {
+				t.Errorf("Expected root %s, got %s", tempDir, cs.Changes[0].Root)
+			}
+			if cs.Time.IsZero() {
+				t.Errorf("Expected change set time to be set")
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("Timed out waiting for change set")
+		}
+	})
+
+	t.Run("NoOpWrites", func(t *testing.T) {
+		tempDir := setupTestDir(t)
+		logger := slog.New(slog.DiscardHandler)
+
+		fw, err := NewFileWatcher(WithLogger(logger))
+		if err != nil {
+			t.Fatalf("Failed to create FileWatcher: %v", err)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		err = fw.AddDirectory(ctx, tempDir)
+		if err != nil {
+			t.Fatalf("AddDirectory failed: %v", err)
+		}
+		signal := fw.Listen(ctx)
+		<-signal
+
+		// Rewriting identical bytes and a backup file that is gone again
+		// leave nothing to report
+		unchanged := filepath.Join(tempDir, "dir1", "file1.txt")
+		if err := os.WriteFile(unchanged, nil, 0o644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+		backup := filepath.Join(tempDir, "dir1", "file1.txt~")
+		if err := os.WriteFile(backup, []byte("backup"), 0o644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+		if err := os.Remove(backup); err != nil {
+			t.Fatalf("Failed to remove file: %v", err)
+		}
+
+		select {
+		case cs := <-signal:
+			t.Fatalf("Expected no change set, got %v", cs.Paths())
+		case <-time.After(500 * time.Millisecond):
+		}
+
+		changed := filepath.Join(tempDir, "dir2", "file3.txt")
+		if err := os.WriteFile(changed, []byte("hello"), 0o644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+		if err := os.WriteFile(unchanged, nil, 0o644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+
+		select {
+		case cs := <-signal:
+			if len(cs.Changes) != 1 || cs.Changes[0].Path != changed {
+				t.Errorf("Expected only %s to change, got %v", changed, cs.Paths())
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("Timed out waiting for change set")
+		}
+
+		// Writing the same content again is a no-op after the change was delivered
+		if err := os.WriteFile(changed, []byte("hello"), 0o644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+		select {
+		case cs := <-signal:
+			t.Fatalf("Expected no change set, got %v", cs.Paths())
+		case <-time.After(500 * time.Millisecond):
+		}
+	})
+}
+
+func TestRootOf(t *testing.T) {
+	roots := []string{"/src", "/src/internal", "/other"}
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/src/main.go", "/src"},
+		{"/src/internal/api/handler.go", "/src/internal"},
+		{"/srcfoo/main.go", ""},
+		{"/other", "/other"},
+	}
+
+	for _, tt := range tests {
+		if got := rootOf(roots, tt.path); got != tt.want {
+			t.Errorf("rootOf(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
@@ -1,12 +1,15 @@
 package work
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"runtime"
 	"time"
 )
@@ -16,24 +19,96 @@ type Builder struct {
 	outBinPath  string
 	buildArgs   []string
 	prebuildCmd string
+	staging     bool
+	debug       bool
+	cover       bool
+	cache       *BinaryCache
+	output      io.Writer
+	events      EventHandler
+	logger      *log.Logger
 }
 
-func NewBuilder(packagePath, outBinPath string, buildArgs []string, prebuildCmd string) *Builder {
-	return &Builder{
+// BuilderOption defines a function type for configuring Builder
+type BuilderOption func(*Builder)
+
+// WithStaging makes the builder compile into a staging path and only replace
+// the output binary once the build succeeds, so a running copy is never
+// clobbered by a failed build.
+func WithStaging() BuilderOption {
+	return func(b *Builder) {
+		b.staging = true
+	}
+}
+
+// WithBuildOutput sets where the prebuild and go build output is written, defaults to os.Stdout
+func WithBuildOutput(w io.Writer) BuilderOption {
+	return func(b *Builder) {
+		b.output = w
+	}
+}
+
+// WithBuildEvents sets the handler receiving prebuild and build events
+func WithBuildEvents(handler EventHandler) BuilderOption {
+	return func(b *Builder) {
+		b.events = handler
+	}
+}
+
+// WithBuildLogger sets the logger for build progress, defaults to the standard logger
+func WithBuildLogger(logger *log.Logger) BuilderOption {
+	return func(b *Builder) {
+		b.logger = logger
+	}
+}
+
+func NewBuilder(packagePath, outBinPath string, buildArgs []string, prebuildCmd string, options ...BuilderOption) *Builder {
+	b := &Builder{
 		packagePath: packagePath,
 		outBinPath:  outBinPath,
 		buildArgs:   buildArgs,
 		prebuildCmd: prebuildCmd,
+		output:      os.Stdout,
+		logger:      log.Default(),
+	}
+
+	for _, option := range options {
+		option(b)
 	}
+	return b
 }
 
-func (b *Builder) Build(ctx context.Context) error {
+// Build runs the prebuild command and compiles the package. The result holds the
+// compiler output and diagnostics, also when the build failed.
+func (b *Builder) Build(ctx context.Context) (BuildResult, error) {
+	var result BuildResult
+	start := time.Now()
+	defer func() {
+		result.Duration = time.Since(start)
+	}()
+
 	err := b.prebuild(ctx)
 	if err != nil {
-		return err
+		return result, err
 	}
-	err = b.build(ctx)
-	return err
+
+	if !b.staging {
+		err = b.build(ctx, b.outBinPath, &result)
+		return result, err
+	}
+
+	// Every build stages into a file of its own, a cancelled build may still
+	// be cleaning up while the next one runs
+	stagingPath, err := tempPath(b.outBinPath, ".staging")
+	if err != nil {
+		return result, err
+	}
+	defer os.Remove(stagingPath)
+
+	err = b.build(ctx, stagingPath, &result)
+	if err != nil {
+		return result, err
+	}
+	return result, swapBinary(stagingPath, b.outBinPath)
 }
 
 func (b *Builder) prebuild(ctx context.Context) error {
@@ -41,61 +116,161 @@ func (b *Builder) prebuild(ctx context.Context) error {
 		return nil
 	}
 
-	var cmd *exec.Cmd
-	if runtime.GOOS == "windows" {
-		cmd = exec.CommandContext(ctx, "cmd", "/C")
-	} else {
-		cmd = exec.CommandContext(ctx, "sh", "-c")
-	}
-	cmd.Args = append(cmd.Args, b.prebuildCmd)
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		return err
-	}
-	stderr, err := cmd.StderrPipe()
+	cmd := shellCommand(ctx, b.prebuildCmd)
+	cmd.Stdout, cmd.Stderr = b.output, b.output
+
+	b.logger.Printf("[Pulse] %s\n", b.prebuildCmd)
+	b.events.Emit(Event{Type: EventPrebuildStart, Command: b.prebuildCmd})
+	start := time.Now()
+
+	err := cmd.Run()
+	end := Event{Type: EventPrebuildEnd, Command: b.prebuildCmd, DurationMS: time.Since(start).Milliseconds()}
 	if err != nil {
-		return err
+		end.Error = err.Error()
 	}
+	b.events.Emit(end)
 
-	go io.Copy(os.Stdout, stdout)
-	go io.Copy(os.Stdout, stderr)
-
-	log.Printf("[Pulse] %s\n", b.prebuildCmd)
-	if err := cmd.Run(); err != nil {
+	if err != nil {
 		return fmt.Errorf("prebuild command failed: %w", err)
 	}
-
 	return nil
 }
 
-func (b *Builder) build(ctx context.Context) (err error) {
-	args := append([]string{"go", "build", "-o", b.outBinPath}, b.buildArgs...)
-	args = append(args, b.packagePath)
+func (b *Builder) build(ctx context.Context, outBinPath string, result *BuildResult) (err error) {
+	flags := b.flags()
 
-	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		return err
-	}
-	stderr, err := cmd.StderrPipe()
-	if err != nil {
-		return err
+	var (
+		inputs *buildInputs
+		key    string
+	)
+	if b.cache != nil {
+		start := time.Now()
+		var cached bool
+		inputs, key, cached = b.fromCache(ctx, flags, outBinPath)
+		if cached {
+			b.logger.Printf("[Pulse] Reused cached build. (%s)\n", time.Since(start))
+			b.events.Emit(Event{Type: EventBuildSuccess, Package: b.packagePath, DurationMS: time.Since(start).Milliseconds(), Cached: true})
+			return nil
+		}
 	}
 
-	go io.Copy(os.Stdout, stdout)
-	go io.Copy(os.Stdout, stderr)
+	args := append([]string{"go", "build", "-o", outBinPath}, flags...)
+	args = append(args, b.packagePath)
+
+	// Stream the output as usual while keeping a copy for the diagnostics
+	var output bytes.Buffer
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdout = io.MultiWriter(b.output, &output)
+	cmd.Stderr = cmd.Stdout
 
-	log.Println("[Pulse] Building...")
+	b.logger.Println("[Pulse] Building...")
+	b.events.Emit(Event{Type: EventBuildStart, Package: b.packagePath})
 	start := time.Now()
 	defer func() {
 		if err == nil {
-			log.Printf("[Pulse] Successfully Build. (%s)\n", time.Since(start))
+			b.logger.Printf("[Pulse] Successfully Build. (%s)\n", time.Since(start))
+			b.events.Emit(Event{Type: EventBuildSuccess, Package: b.packagePath, DurationMS: time.Since(start).Milliseconds()})
+		} else if ctx.Err() == nil {
+			b.events.Emit(Event{
+				Type:        EventBuildFailure,
+				Package:     b.packagePath,
+				DurationMS:  time.Since(start).Milliseconds(),
+				Error:       err.Error(),
+				Diagnostics: result.Diagnostics,
+			})
 		}
 	}()
 
-	if err := cmd.Run(); err != nil {
+	err = cmd.Run()
+	result.Output = output.String()
+
+	if err != nil {
+		dir, _ := os.Getwd()
+		result.Diagnostics = parseDiagnostics(result.Output, dir)
+		switch n := len(result.Diagnostics); {
+		case n == 1:
+			return fmt.Errorf("build failed for package %s: %s", b.packagePath, result.Diagnostics[0])
+		case n > 1:
+			return fmt.Errorf("build failed for package %s: %s (and %d more errors)", b.packagePath, result.Diagnostics[0], n-1)
+		}
 		return fmt.Errorf("build failed for package %s: %w", b.packagePath, err)
 	}
 
+	if inputs != nil {
+		b.toCache(inputs, key, outBinPath)
+	}
+	return nil
+}
+
+// flags returns the go build flags of the package
+func (b *Builder) flags() []string {
+	var flags []string
+	if b.debug {
+		// Before the build arguments so -gcflags given there take precedence
+		flags = append(flags, debugGCFlags)
+	}
+	if b.cover {
+		flags = append(flags, "-cover")
+	}
+	return append(flags, b.buildArgs...)
+}
+
+// fromCache copies a cached build of the sources to outBinPath. It returns the
+// inputs of the build, nil if they couldn't be listed, their key and whether
+// there was a cached build.
+func (b *Builder) fromCache(ctx context.Context, flags []string, outBinPath string) (*buildInputs, string, bool) {
+	inputs, err := listBuildInputs(ctx, b.packagePath, flags)
+	if err != nil {
+		if ctx.Err() == nil {
+			b.logger.Printf("[Pulse] failed to compute the cache key, building without cache: %v\n", err)
+		}
+		return nil, "", false
+	}
+
+	key := inputs.key()
+	ok, err := b.cache.Get(key, outBinPath)
+	if err != nil {
+		b.logger.Printf("[Pulse] %v\n", err)
+	}
+	return inputs, key, ok
+}
+
+// toCache adds the binary at outBinPath to the cache under key, the key of the
+// inputs when the build started. Sources edited while building may have gone
+// into the binary, so it is only added if hashing them again gives the same key.
+// The listing isn't repeated, the build was made from the listed files.
+func (b *Builder) toCache(inputs *buildInputs, key, outBinPath string) {
+	if inputs.key() != key {
+		return
+	}
+	if err := b.cache.Put(key, outBinPath); err != nil {
+		b.logger.Printf("[Pulse] %v\n", err)
+	}
+}
+
+// tempPath creates an empty file next to path with a unique name ending in suffix
+func tempPath(path, suffix string) (string, error) {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*"+suffix)
+	if err != nil {
+		return "", fmt.Errorf("create temporary file: %w", err)
+	}
+	f.Close()
+	return f.Name(), nil
+}
+
+// swapBinary atomically replaces dst with src. Windows refuses to overwrite a
+// running executable but allows renaming it, so the old binary is moved aside first.
+func swapBinary(src, dst string) error {
+	if runtime.GOOS == "windows" {
+		old := dst + ".old"
+		_ = os.Remove(old)
+		if err := os.Rename(dst, old); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("move aside binary %s: %w", dst, err)
+		}
+	}
+
+	if err := os.Rename(src, dst); err != nil {
+		return fmt.Errorf("swap binary %s: %w", dst, err)
+	}
 	return nil
 }
@@ -0,0 +1,72 @@
+package work
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBuilder_Staging(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"go.mod":  "module example.com/m\n\ngo 1.24\n",
+		"main.go": "package main\n\nfunc main() {}\n",
+	})
+	t.Chdir(dir)
+
+	binDir := t.TempDir()
+	bin := filepath.Join(binDir, "app")
+	b := NewBuilder(dir, bin, nil, "", WithStaging(), WithBuildOutput(io.Discard), WithBuildLogger(log.New(io.Discard, "", 0)))
+	ctx := context.Background()
+
+	if _, err := b.Build(ctx); err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	built, err := os.ReadFile(bin)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeFiles(t, dir, map[string]string{"main.go": "package main\n\nfunc main() { undefined() }\n"})
+	if _, err := b.Build(ctx); err == nil {
+		t.Fatal("Build() of broken sources succeeded")
+	}
+
+	// The previous binary keeps running until a build succeeds
+	if kept, err := os.ReadFile(bin); err != nil || !bytes.Equal(kept, built) {
+		t.Errorf("failed build replaced the binary: %v", err)
+	}
+	entries, err := os.ReadDir(binDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		t.Errorf("staging files left behind: %q", names)
+	}
+}
+
+func TestTempPath(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app")
+	a, err := tempPath(path, ".staging")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := tempPath(path, ".staging")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a == b {
+		t.Errorf("tempPath() returned %s twice", a)
+	}
+	if filepath.Dir(a) != filepath.Dir(path) || filepath.Ext(a) != ".staging" {
+		t.Errorf("tempPath() = %s, want a .staging file next to %s", a, path)
+	}
+}
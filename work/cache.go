@@ -0,0 +1,233 @@
+package work
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BinaryCache keeps built binaries keyed by a hash of everything that goes
+// into the build, so a build of sources that were built before, e.g. after
+// switching branches back and forth, is a copy instead of a compile. The least
+// recently used binaries are evicted once the cache grows beyond its size limit.
+type BinaryCache struct {
+	dir      string
+	maxBytes int64
+
+	mu sync.Mutex
+}
+
+// NewBinaryCache returns a cache keeping up to maxBytes of binaries in dir
+func NewBinaryCache(dir string, maxBytes int64) (*BinaryCache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create binary cache: %w", err)
+	}
+	return &BinaryCache{dir: dir, maxBytes: maxBytes}, nil
+}
+
+// WithBinaryCache reuses binaries from the cache when the sources were built before
+func WithBinaryCache(c *BinaryCache) BuilderOption {
+	return func(b *Builder) {
+		b.cache = c
+	}
+}
+
+// cacheEnv are the go env variables that change the binary built from the same sources
+var cacheEnv = []string{"GOVERSION", "GOOS", "GOARCH", "GOARM", "GOAMD64", "GOARM64", "CGO_ENABLED", "GOFLAGS", "GOEXPERIMENT", "GOMOD", "GOWORK"}
+
+// buildInputs lists what goes into building a package. Listing them runs go env
+// and go list, the key hashes the listed files and can be computed again cheaply.
+type buildInputs struct {
+	packagePath string
+	flags       []string
+	env         []string
+	packages    []listedPackage
+}
+
+// listBuildInputs lists the toolchain and target platform, the module and
+// workspace files and the dependencies of building packagePath with flags
+func listBuildInputs(ctx context.Context, packagePath string, flags []string) (*buildInputs, error) {
+	dir, _ := packageDir(packagePath)
+	cmd := exec.CommandContext(ctx, "go", append([]string{"env"}, cacheEnv...)...)
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("go env: %w", err)
+	}
+
+	packages, err := listDepsFields(ctx, packagePath, flags, "Dir,ImportPath,Standard,Module,GoFiles,CgoFiles,CFiles,CXXFiles,HFiles,SFiles,SysoFiles,EmbedFiles")
+	if err != nil {
+		return nil, err
+	}
+	return &buildInputs{
+		packagePath: packagePath,
+		flags:       flags,
+		env:         strings.Split(strings.TrimSpace(string(out)), "\n"),
+		packages:    packages,
+	}, nil
+}
+
+// key returns the cache key of the build. It hashes the toolchain and target
+// platform, the flags, the module and workspace files, the sources of the main
+// module packages and the versions of the dependencies. The standard library is
+// covered by the toolchain version.
+func (in *buildInputs) key() string {
+	h := sha256.New()
+	fmt.Fprintf(h, "env %q\nflags %q\npackage %s\n", in.env, in.flags, in.packagePath)
+	for _, name := range in.env {
+		switch filepath.Base(name) {
+		case "go.mod":
+			hashFiles(h, name, strings.TrimSuffix(name, ".mod")+".sum")
+		case "go.work":
+			hashFiles(h, name, name+".sum")
+		}
+	}
+	for _, p := range in.packages {
+		switch m := p.Module; {
+		case p.Standard:
+			continue
+		case m != nil && !m.Main && m.Replace == nil && m.Version != "":
+			// Module versions are immutable
+			fmt.Fprintf(h, "package %s %s@%s\n", p.ImportPath, m.Path, m.Version)
+			continue
+		}
+
+		fmt.Fprintf(h, "package %s %s\n", p.ImportPath, p.Dir)
+		files := slices.Concat(p.GoFiles, p.CgoFiles, p.CFiles, p.CXXFiles, p.HFiles, p.SFiles, p.SysoFiles, p.EmbedFiles)
+		for i, f := range files {
+			files[i] = filepath.Join(p.Dir, f)
+		}
+		hashFiles(h, files...)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// hashFiles writes the name and content of every file to h, or only the name
+// if the file can't be read
+func hashFiles(h io.Writer, paths ...string) {
+	for _, path := range paths {
+		fmt.Fprintf(h, "file %s\n", path)
+		f, err := os.Open(path)
+		if err != nil {
+			fmt.Fprintf(h, "error %v\n", errors.Unwrap(err))
+			continue
+		}
+		_, _ = io.Copy(h, f)
+		f.Close()
+	}
+}
+
+// Get copies the binary cached under key to dst and reports whether there was one
+func (c *BinaryCache) Get(key, dst string) (bool, error) {
+	path := filepath.Join(c.dir, key)
+	if _, err := os.Stat(path); err != nil {
+		return false, nil
+	}
+
+	// The modification time tells which binaries were used last
+	now := time.Now()
+	_ = os.Chtimes(path, now, now)
+
+	tmp, err := tempPath(dst, ".cached")
+	if err != nil {
+		return false, err
+	}
+	if err := copyFile(path, tmp); err != nil {
+		os.Remove(tmp)
+		return false, fmt.Errorf("copy cached binary: %w", err)
+	}
+	// The binary at dst may still be running
+	if err := swapBinary(tmp, dst); err != nil {
+		os.Remove(tmp)
+		return false, err
+	}
+	return true, nil
+}
+
+// Put adds the binary at src to the cache under key and evicts the least
+// recently used binaries beyond the size limit
+func (c *BinaryCache) Put(key, src string) error {
+	tmp, err := os.CreateTemp(c.dir, key+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("add binary to cache: %w", err)
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	if err := copyFile(src, tmp.Name()); err != nil {
+		return fmt.Errorf("add binary to cache: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(c.dir, key)); err != nil {
+		return fmt.Errorf("add binary to cache: %w", err)
+	}
+	return c.evict()
+}
+
+// evict removes the least recently used binaries until the cache fits its size limit
+func (c *BinaryCache) evict() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return fmt.Errorf("read binary cache: %w", err)
+	}
+
+	var (
+		binaries []fs.FileInfo
+		total    int64
+	)
+	for _, e := range entries {
+		if strings.HasSuffix(e.Name(), ".tmp") {
+			continue
+		}
+		fi, err := e.Info()
+		if err != nil || !fi.Mode().IsRegular() {
+			continue
+		}
+		binaries = append(binaries, fi)
+		total += fi.Size()
+	}
+
+	slices.SortFunc(binaries, func(a, b fs.FileInfo) int { return a.ModTime().Compare(b.ModTime()) })
+	for _, fi := range binaries {
+		if total <= c.maxBytes {
+			break
+		}
+		if err := os.Remove(filepath.Join(c.dir, fi.Name())); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("evict cached binary: %w", err)
+		}
+		total -= fi.Size()
+	}
+	return nil
+}
+
+// copyFile copies src to dst with the permissions of an executable
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o755)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
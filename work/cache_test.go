@@ -0,0 +1,182 @@
+package work
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuildInputs_Key(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"go.mod":        "module example.com/m\n\ngo 1.24\n",
+		"main.go":       "package main\n\nimport _ \"example.com/m/lib\"\n\nfunc main() {}\n",
+		"lib/lib.go":    "package lib\n",
+		"lib/README.md": "docs\n",
+	})
+	t.Chdir(dir)
+
+	key := func(flags ...string) string {
+		t.Helper()
+		inputs, err := listBuildInputs(context.Background(), dir, flags)
+		if err != nil {
+			t.Fatalf("listBuildInputs() error = %v", err)
+		}
+		return inputs.key()
+	}
+
+	base := key()
+	if got := key("-tags=dev"); got == base {
+		t.Error("key() ignores build flags")
+	}
+
+	writeFiles(t, dir, map[string]string{"lib/README.md": "more docs\n"})
+	if got := key(); got != base {
+		t.Error("key() changed with a file that isn't part of the build")
+	}
+
+	writeFiles(t, dir, map[string]string{"lib/lib.go": "package lib\n\nvar X = 1\n"})
+	changed := key()
+	if changed == base {
+		t.Error("key() didn't change with a dependency")
+	}
+
+	writeFiles(t, dir, map[string]string{"lib/lib.go": "package lib\n"})
+	if got := key(); got != base {
+		t.Error("key() differs after restoring the sources")
+	}
+}
+
+func TestBinaryCache_GetPut(t *testing.T) {
+	dir := t.TempDir()
+	c, err := NewBinaryCache(filepath.Join(dir, "cache"), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bin := filepath.Join(dir, "bin")
+	if ok, err := c.Get("a", bin); ok || err != nil {
+		t.Fatalf("Get() = %v, %v on an empty cache", ok, err)
+	}
+
+	writeFiles(t, dir, map[string]string{"a": "aaaa", "b": "bbbb", "c": "cccc"})
+	for _, key := range []string{"a", "b"} {
+		if err := c.Put(key, filepath.Join(dir, key)); err != nil {
+			t.Fatalf("Put(%s) error = %v", key, err)
+		}
+		// Modification times tell the order of use
+		old := time.Now().Add(-time.Hour)
+		if key == "a" {
+			old = old.Add(-time.Hour)
+		}
+		os.Chtimes(filepath.Join(dir, "cache", key), old, old)
+	}
+
+	// Using a makes b the least recently used binary
+	if ok, err := c.Get("a", bin); !ok || err != nil {
+		t.Fatalf("Get(a) = %v, %v", ok, err)
+	}
+	if content, _ := os.ReadFile(bin); string(content) != "aaaa" {
+		t.Errorf("Get(a) copied %q", content)
+	}
+
+	if err := c.Put("c", filepath.Join(dir, "c")); err != nil {
+		t.Fatalf("Put(c) error = %v", err)
+	}
+	for key, want := range map[string]bool{"a": true, "b": false, "c": true} {
+		_, err := os.Stat(filepath.Join(dir, "cache", key))
+		if got := err == nil; got != want {
+			t.Errorf("%s cached = %v, want %v", key, got, want)
+		}
+	}
+}
+
+func TestBuilder_ToCache(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"go.mod":  "module example.com/m\n\ngo 1.24\n",
+		"main.go": "package main\n\nfunc main() {}\n",
+		"bin":     "binary",
+	})
+	t.Chdir(dir)
+
+	c, err := NewBinaryCache(filepath.Join(dir, "cache"), 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := NewBuilder(dir, filepath.Join(dir, "bin"), nil, "", WithBinaryCache(c))
+	ctx := context.Background()
+
+	inputs, err := listBuildInputs(ctx, dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := inputs.key()
+
+	// The sources changed while building
+	writeFiles(t, dir, map[string]string{"main.go": "package main\n\nfunc main() { println() }\n"})
+	b.toCache(inputs, key, filepath.Join(dir, "bin"))
+	if _, err := os.Stat(filepath.Join(dir, "cache", key)); !os.IsNotExist(err) {
+		t.Error("toCache() cached a binary of sources that changed during the build")
+	}
+
+	// Hashing the listed sources again is enough to tell
+	key = inputs.key()
+	b.toCache(inputs, key, filepath.Join(dir, "bin"))
+	if _, err := os.Stat(filepath.Join(dir, "cache", key)); err != nil {
+		t.Errorf("toCache() didn't cache the binary: %v", err)
+	}
+}
+
+func TestBuilder_Cached(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"go.mod":  "module example.com/m\n\ngo 1.24\n",
+		"main.go": "package main\n\nfunc main() {}\n",
+	})
+	t.Chdir(dir)
+
+	c, err := NewBinaryCache(filepath.Join(t.TempDir(), "cache"), 1<<30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		logs   bytes.Buffer
+		events []EventType
+	)
+	b := NewBuilder(dir, filepath.Join(t.TempDir(), "app"), nil, "",
+		WithBinaryCache(c),
+		WithBuildOutput(io.Discard),
+		WithBuildLogger(log.New(&logs, "", 0)),
+		WithBuildEvents(func(e Event) { events = append(events, e.Type) }),
+	)
+
+	tests := []struct {
+		wantLogs   string
+		wantEvents []EventType
+	}{
+		{"[Pulse] Building...\n[Pulse] Successfully Build.", []EventType{EventBuildStart, EventBuildSuccess}},
+		// A cached build is not announced as a build
+		{"[Pulse] Reused cached build.", []EventType{EventBuildSuccess}},
+	}
+	for i, tt := range tests {
+		logs.Reset()
+		events = nil
+		if _, err := b.Build(context.Background()); err != nil {
+			t.Fatalf("Build() %d error = %v", i, err)
+		}
+		if !strings.HasPrefix(logs.String(), tt.wantLogs) {
+			t.Errorf("Build() %d logged %q, want %q", i, logs.String(), tt.wantLogs)
+		}
+		if !slices.Equal(events, tt.wantEvents) {
+			t.Errorf("Build() %d emitted %v, want %v", i, events, tt.wantEvents)
+		}
+	}
+}
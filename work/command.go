@@ -0,0 +1,25 @@
+package work
+
+import (
+	"context"
+	"io"
+	"os/exec"
+	"runtime"
+)
+
+// RunCommand runs command through the system shell in dir and writes its
+// output to w
+func RunCommand(ctx context.Context, dir, command string, w io.Writer) error {
+	cmd := shellCommand(ctx, command)
+	cmd.Dir = dir
+	cmd.Stdout, cmd.Stderr = w, w
+	return cmd.Run()
+}
+
+// shellCommand returns a command running command through the system shell
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", command)
+	}
+	return exec.CommandContext(ctx, "sh", "-c", command)
+}
@@ -0,0 +1,154 @@
+package work
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Coverage collects the coverage counters written by processes built with
+// -cover into a cumulative report. Every process writes into a directory of
+// its own, which is merged into the report once the process exited.
+type Coverage struct {
+	dir      string
+	htmlPath string
+
+	mu sync.Mutex
+}
+
+// CoverageOption defines a function type for configuring Coverage
+type CoverageOption func(*Coverage)
+
+// WithCoverageHTML also renders the report as HTML to path after every merge
+func WithCoverageHTML(path string) CoverageOption {
+	return func(c *Coverage) {
+		c.htmlPath = path
+	}
+}
+
+// NewCoverage returns a collector keeping its data and reports in dir:
+// merged counters in dir/data and the text profile in dir/coverage.out
+func NewCoverage(dir string, options ...CoverageOption) (*Coverage, error) {
+	c := &Coverage{dir: dir}
+	for _, option := range options {
+		option(c)
+	}
+
+	if err := os.MkdirAll(filepath.Join(dir, "runs"), 0o755); err != nil {
+		return nil, fmt.Errorf("create coverage directory: %w", err)
+	}
+	return c, nil
+}
+
+// ProfilePath returns the path of the cumulative text profile
+func (c *Coverage) ProfilePath() string {
+	return filepath.Join(c.dir, "coverage.out")
+}
+
+// HTMLPath returns the path of the HTML report, empty if there is none
+func (c *Coverage) HTMLPath() string {
+	return c.htmlPath
+}
+
+// WithCoverageBuild compiles the package with coverage instrumentation
+func WithCoverageBuild() BuilderOption {
+	return func(b *Builder) {
+		b.cover = true
+	}
+}
+
+// WithCoverage sets the collector the process writes its coverage counters to
+func WithCoverage(c *Coverage) RunnerOption {
+	return func(r *Runner) {
+		r.coverage = c
+	}
+}
+
+// runDir creates the directory a process writes its counters to
+func (c *Coverage) runDir() (string, error) {
+	dir, err := os.MkdirTemp(filepath.Join(c.dir, "runs"), "run")
+	if err != nil {
+		return "", fmt.Errorf("create coverage run directory: %w", err)
+	}
+	return dir, nil
+}
+
+// merge adds the counters in runDir to the cumulative data, removes runDir
+// and writes the reports. A process only writes counters when it exits
+// normally, there is nothing to merge if it was killed.
+func (c *Coverage) merge(ctx context.Context, runDir string) error {
+	defer os.RemoveAll(runDir)
+
+	counters, err := filepath.Glob(filepath.Join(runDir, "covcounters.*"))
+	if err != nil || len(counters) == 0 {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data := filepath.Join(c.dir, "data")
+	inputs := runDir
+	if _, err := os.Stat(data); err == nil {
+		inputs = data + "," + runDir
+	}
+
+	// Merge into a new directory and swap it in, so the data is never lost
+	// halfway through
+	merged := data + ".new"
+	if err := os.RemoveAll(merged); err != nil {
+		return err
+	}
+	if err := os.Mkdir(merged, 0o755); err != nil {
+		return err
+	}
+	// Every rebuild is a distinct program to covdata
+	if _, err := goTool(ctx, "covdata", "merge", "-pcombine", "-i="+inputs, "-o="+merged); err != nil {
+		os.RemoveAll(merged)
+		return fmt.Errorf("merge coverage: %w", err)
+	}
+	if err := os.RemoveAll(data); err != nil {
+		return err
+	}
+	if err := os.Rename(merged, data); err != nil {
+		return err
+	}
+
+	if _, err := goTool(ctx, "covdata", "textfmt", "-i="+data, "-o="+c.ProfilePath()); err != nil {
+		return fmt.Errorf("write coverage profile: %w", err)
+	}
+	if c.htmlPath != "" {
+		if _, err := goTool(ctx, "cover", "-html="+c.ProfilePath(), "-o="+c.htmlPath); err != nil {
+			return fmt.Errorf("write coverage html: %w", err)
+		}
+	}
+	return nil
+}
+
+// Percent returns the statement coverage of every package in the cumulative data
+func (c *Coverage) Percent(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data := filepath.Join(c.dir, "data")
+	if _, err := os.Stat(data); err != nil {
+		return "", nil
+	}
+	return goTool(ctx, "covdata", "percent", "-i="+data)
+}
+
+// goTool runs go tool with args and returns its output
+func goTool(ctx context.Context, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "go", append([]string{"tool"}, args...)...)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
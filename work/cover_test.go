@@ -0,0 +1,83 @@
+package work
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCoverage(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"go.mod": "module example.com/m\n\ngo 1.24\n",
+		"main.go": `package main
+
+import "os"
+
+func main() {
+	if os.Args[1] == "a" {
+		println("a")
+	} else {
+		println("b")
+	}
+}
+`,
+	})
+	t.Chdir(dir)
+
+	ctx := context.Background()
+	bin := filepath.Join(dir, "app")
+	b := NewBuilder(dir, bin, nil, "", WithCoverageBuild(), WithBuildOutput(io.Discard), WithBuildLogger(log.New(io.Discard, "", 0)))
+	if _, err := b.Build(ctx); err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+
+	c, err := NewCoverage(filepath.Join(dir, "cover"), WithCoverageHTML(filepath.Join(dir, "cover.html")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, arg := range []string{"a", "b"} {
+		runDir, err := c.runDir()
+		if err != nil {
+			t.Fatal(err)
+		}
+		cmd := exec.Command(bin, arg)
+		cmd.Env = append(os.Environ(), "GOCOVERDIR="+runDir)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("run %s: %v: %s", arg, err, out)
+		}
+		if err := c.merge(ctx, runDir); err != nil {
+			t.Fatalf("merge() error = %v", err)
+		}
+		if _, err := os.Stat(runDir); !os.IsNotExist(err) {
+			t.Errorf("run directory %s not removed", runDir)
+		}
+	}
+
+	profile, err := os.ReadFile(c.ProfilePath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every block is covered by one of the runs
+	for _, line := range strings.Split(strings.TrimSpace(string(profile)), "\n")[1:] {
+		if !strings.HasSuffix(line, " 1") {
+			t.Errorf("block not covered: %s", line)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "cover.html")); err != nil {
+		t.Errorf("html report: %v", err)
+	}
+
+	percent, err := c.Percent(ctx)
+	if err != nil {
+		t.Fatalf("Percent() error = %v", err)
+	}
+	if !strings.Contains(percent, "100.0%") {
+		t.Errorf("Percent() = %q, want 100.0%%", percent)
+	}
+}
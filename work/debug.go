@@ -0,0 +1,53 @@
+package work
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+)
+
+// debugGCFlags disables optimizations and inlining so the debugger can step
+// through the code and inspect every variable
+const debugGCFlags = "-gcflags=all=-N -l"
+
+// WithDebugBuild compiles the package for debugging with optimizations and
+// inlining disabled
+func WithDebugBuild() BuilderOption {
+	return func(b *Builder) {
+		b.debug = true
+	}
+}
+
+// WithDebugger runs the binary under a headless Delve server listening on addr.
+// The server is restarted on the same address with every process so remote
+// debug clients can reconnect.
+func WithDebugger(addr string) RunnerOption {
+	return func(r *Runner) {
+		r.debugAddr = addr
+	}
+}
+
+// debuggerArgs returns the dlv arguments running binPath with args under a
+// headless server on addr. The program continues right away instead of
+// waiting for a client to attach.
+func debuggerArgs(addr, binPath string, args []string) []string {
+	dlvArgs := []string{"exec", "--headless", "--listen=" + addr, "--accept-multiclient", "--continue", "--api-version=2", binPath}
+	if len(args) > 0 {
+		dlvArgs = append(append(dlvArgs, "--"), args...)
+	}
+	return dlvArgs
+}
+
+// DebugAddr returns the debugger address of the n-th target, counting from 0.
+// Every target after the first gets the next port.
+func DebugAddr(addr string, n int) (string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", fmt.Errorf("parse debugger address %s: %w", addr, err)
+	}
+	p, err := strconv.Atoi(port)
+	if err != nil {
+		return "", fmt.Errorf("parse debugger port %s: %w", port, err)
+	}
+	return net.JoinHostPort(host, strconv.Itoa(p+n)), nil
+}
@@ -0,0 +1,46 @@
+package work
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestDebuggerArgs(t *testing.T) {
+	got := debuggerArgs("127.0.0.1:2345", "/tmp/app", nil)
+	want := []string{"exec", "--headless", "--listen=127.0.0.1:2345", "--accept-multiclient", "--continue", "--api-version=2", "/tmp/app"}
+	if !slices.Equal(got, want) {
+		t.Errorf("debuggerArgs() = %q, want %q", got, want)
+	}
+
+	got = debuggerArgs("127.0.0.1:2345", "/tmp/app", []string{"-port", "8080"})
+	want = append(want, "--", "-port", "8080")
+	if !slices.Equal(got, want) {
+		t.Errorf("debuggerArgs() = %q, want %q", got, want)
+	}
+}
+
+func TestDebugAddr(t *testing.T) {
+	tests := []struct {
+		addr    string
+		n       int
+		want    string
+		wantErr bool
+	}{
+		{"127.0.0.1:2345", 0, "127.0.0.1:2345", false},
+		{"127.0.0.1:2345", 2, "127.0.0.1:2347", false},
+		{":40000", 1, ":40001", false},
+		{"localhost", 0, "", true},
+		{"localhost:dlv", 0, "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := DebugAddr(tt.addr, tt.n)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("DebugAddr(%q, %d) error = %v, wantErr %v", tt.addr, tt.n, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("DebugAddr(%q, %d) = %q, want %q", tt.addr, tt.n, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,378 @@
+package work
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DepGraph tells which targets a changed file affects, based on the transitive
+// imports of each target package as reported by go list. It is reloaded when
+// go.mod or go.work change or a file gains an import the graph doesn't know.
+type DepGraph struct {
+	mu    sync.Mutex
+	roots map[string]*rootDeps
+	// imports holds the imports of every loaded package by directory
+	imports map[string][]string
+	// embeds holds every embedded file of any loaded package
+	embeds map[string]bool
+	// generation counts invalidations, a Load started before the latest one
+	// doesn't store its outdated result
+	generation int
+}
+
+// rootDeps is the dependency closure of a target package
+type rootDeps struct {
+	packagePath string
+	buildArgs   []string
+	loaded      bool
+	dirs        map[string]bool
+	embeds      map[string]bool
+}
+
+// listedPackage is the subset of go list -json output the graph uses
+type listedPackage struct {
+	Dir          string
+	ImportPath   string
+	Standard     bool
+	DepOnly      bool
+	Imports      []string
+	TestImports  []string
+	XTestImports []string
+	EmbedFiles   []string
+	GoFiles      []string
+	CgoFiles     []string
+	CFiles       []string
+	CXXFiles     []string
+	HFiles       []string
+	SFiles       []string
+	SysoFiles    []string
+	Module       *listedModule
+}
+
+// listedModule is the module of a listed package
+type listedModule struct {
+	Path    string
+	Version string
+	Main    bool
+	Replace *listedModule
+}
+
+// NewDepGraph returns an empty graph. Targets are added with AddRoot and
+// loaded with Load.
+func NewDepGraph() *DepGraph {
+	return &DepGraph{
+		roots:   make(map[string]*rootDeps),
+		imports: make(map[string][]string),
+		embeds:  make(map[string]bool),
+	}
+}
+
+// AddRoot adds a target package, a directory or a .go file, built with buildArgs
+func (g *DepGraph) AddRoot(packagePath string, buildArgs []string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.roots[packagePath] = &rootDeps{packagePath: packagePath, buildArgs: buildArgs}
+}
+
+// Load runs go list for every root. A root that fails to load affects every file.
+func (g *DepGraph) Load(ctx context.Context) error {
+	g.mu.Lock()
+	generation := g.generation
+	roots := make([]*rootDeps, 0, len(g.roots))
+	for _, root := range g.roots {
+		roots = append(roots, &rootDeps{packagePath: root.packagePath, buildArgs: root.buildArgs})
+	}
+	g.mu.Unlock()
+
+	imports := make(map[string][]string)
+	embeds := make(map[string]bool)
+	var errs []error
+	for _, root := range roots {
+		packages, err := listDeps(ctx, root.packagePath, root.buildArgs)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		root.loaded = true
+		root.dirs = make(map[string]bool)
+		root.embeds = make(map[string]bool)
+		for _, p := range packages {
+			if p.Standard || p.Dir == "" {
+				continue
+			}
+			root.dirs[p.Dir] = true
+			imports[p.Dir] = p.Imports
+			for _, f := range p.EmbedFiles {
+				path := filepath.Join(p.Dir, f)
+				root.embeds[path] = true
+				embeds[path] = true
+			}
+		}
+	}
+
+	g.mu.Lock()
+	if g.generation == generation {
+		for _, root := range roots {
+			g.roots[root.packagePath] = root
+		}
+		g.imports, g.embeds = imports, embeds
+	}
+	g.mu.Unlock()
+	return errors.Join(errs...)
+}
+
+// Invalidate marks every root unloaded if any of paths changes the module setup
+// or adds an import to a loaded package, so every file affects every target
+// until Load ran again. It reports whether the graph was invalidated.
+func (g *DepGraph) Invalidate(paths []string) bool {
+	if !slices.ContainsFunc(paths, g.stale) {
+		return false
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.generation++
+	for _, root := range g.roots {
+		root.loaded = false
+	}
+	return true
+}
+
+// stale reports whether a change to path may have changed the graph
+func (g *DepGraph) stale(path string) bool {
+	switch filepath.Base(path) {
+	case "go.mod", "go.sum", "go.work", "go.work.sum":
+		return true
+	}
+	if filepath.Ext(path) != ".go" || strings.HasSuffix(path, "_test.go") {
+		return false
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	g.mu.Lock()
+	known, ok := g.imports[filepath.Dir(abs)]
+	g.mu.Unlock()
+	if !ok {
+		// Nothing imports a package the graph doesn't know yet
+		return false
+	}
+
+	f, err := parser.ParseFile(token.NewFileSet(), abs, nil, parser.ImportsOnly)
+	if err != nil {
+		return false
+	}
+	for _, spec := range f.Imports {
+		importPath, err := strconv.Unquote(spec.Path.Value)
+		if err == nil && importPath != "C" && !slices.Contains(known, importPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// Affects reports whether a change to path requires rebuilding the target
+// package. Test files never do, Go files do when their package is a dependency
+// of the target, and other files when the target embeds them or no package
+// embeds them at all.
+func (g *DepGraph) Affects(packagePath, path string) bool {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return true
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	root, ok := g.roots[packagePath]
+	if !ok || !root.loaded {
+		return true
+	}
+
+	switch {
+	case strings.HasSuffix(abs, "_test.go"):
+		return false
+	case filepath.Ext(abs) == ".go":
+		return root.dirs[filepath.Dir(abs)]
+	case root.embeds[abs]:
+		return true
+	default:
+		return !g.embeds[abs]
+	}
+}
+
+// listDeps returns the target package and all its dependencies
+func listDeps(ctx context.Context, packagePath string, buildArgs []string) ([]listedPackage, error) {
+	return listDepsFields(ctx, packagePath, buildArgs, "Dir,ImportPath,Standard,Imports,EmbedFiles")
+}
+
+// listDepsFields returns the target package and all its dependencies with the
+// given go list -json fields
+func listDepsFields(ctx context.Context, packagePath string, buildArgs []string, fields string) ([]listedPackage, error) {
+	dir, pattern := packageDir(packagePath)
+	args := append([]string{"-deps", "-json=" + fields}, buildArgs...)
+	packages, err := goList(ctx, dir, append(args, pattern))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", packagePath, err)
+	}
+	return packages, nil
+}
+
+// packageDir returns the directory to run go commands for a target package in
+// and the package pattern to use there
+func packageDir(packagePath string) (dir, pattern string) {
+	if fi, err := os.Stat(packagePath); err == nil && !fi.IsDir() {
+		return filepath.Dir(packagePath), filepath.Base(packagePath)
+	}
+	return packagePath, "."
+}
+
+// AffectedPackages returns the import paths of the packages matching patterns
+// whose tests are affected by changes to paths: the packages the files belong
+// to and every package importing them, directly, indirectly or from its tests.
+// Changes to go.mod or go.work affect every package.
+func AffectedPackages(ctx context.Context, patterns, buildArgs, paths []string) ([]string, error) {
+	args := append([]string{"-deps", "-json=Dir,ImportPath,Standard,DepOnly,Imports,TestImports,XTestImports,EmbedFiles"}, buildArgs...)
+	packages, err := goList(ctx, ".", append(args, patterns...))
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		inScope     = make(map[string]bool)
+		byDir       = make(map[string]string)
+		embeddedBy  = make(map[string]string)
+		importers   = make(map[string][]string)
+		testImports = make(map[string][]string)
+	)
+	for _, p := range packages {
+		if p.Standard || p.Dir == "" {
+			continue
+		}
+		inScope[p.ImportPath] = !p.DepOnly
+		byDir[p.Dir] = p.ImportPath
+		for _, f := range p.EmbedFiles {
+			embeddedBy[filepath.Join(p.Dir, f)] = p.ImportPath
+		}
+		for _, imp := range p.Imports {
+			importers[imp] = append(importers[imp], p.ImportPath)
+		}
+		for _, imp := range slices.Concat(p.TestImports, p.XTestImports) {
+			testImports[imp] = append(testImports[imp], p.ImportPath)
+		}
+	}
+
+	// Packages whose code changed affect their importers, packages whose
+	// tests or test data changed only affect themselves
+	var changed, testOnly []string
+	for _, path := range paths {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			continue
+		}
+		switch base := filepath.Base(abs); {
+		case base == "go.mod" || base == "go.sum" || base == "go.work" || base == "go.work.sum":
+			return scopeOf(inScope), nil
+		case strings.HasSuffix(base, "_test.go"):
+			if p, ok := byDir[filepath.Dir(abs)]; ok {
+				testOnly = append(testOnly, p)
+			}
+		case filepath.Ext(base) == ".go":
+			if p, ok := byDir[filepath.Dir(abs)]; ok {
+				changed = append(changed, p)
+			}
+		case embeddedBy[abs] != "":
+			changed = append(changed, embeddedBy[abs])
+		default:
+			// Test data belongs to the closest package above it
+			for dir := filepath.Dir(abs); dir != filepath.Dir(dir); dir = filepath.Dir(dir) {
+				if p, ok := byDir[dir]; ok {
+					testOnly = append(testOnly, p)
+					break
+				}
+			}
+		}
+	}
+
+	affected := make(map[string]bool)
+	for _, p := range testOnly {
+		affected[p] = true
+	}
+	seen := make(map[string]bool)
+	for len(changed) > 0 {
+		p := changed[len(changed)-1]
+		changed = changed[:len(changed)-1]
+		if seen[p] {
+			continue
+		}
+		seen[p] = true
+		affected[p] = true
+
+		changed = append(changed, importers[p]...)
+		for _, importer := range testImports[p] {
+			affected[importer] = true
+		}
+	}
+
+	var result []string
+	for p := range affected {
+		if inScope[p] {
+			result = append(result, p)
+		}
+	}
+	slices.Sort(result)
+	return result, nil
+}
+
+// scopeOf returns the sorted import paths of the packages in scope
+func scopeOf(inScope map[string]bool) []string {
+	var result []string
+	for p, ok := range inScope {
+		if ok {
+			result = append(result, p)
+		}
+	}
+	slices.Sort(result)
+	return result
+}
+
+// goList runs go list -e with args in dir and decodes the listed packages
+func goList(ctx context.Context, dir string, args []string) ([]listedPackage, error) {
+	cmd := exec.CommandContext(ctx, "go", append([]string{"list", "-e"}, args...)...)
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("go list: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	var packages []listedPackage
+	dec := json.NewDecoder(bytes.NewReader(out))
+	for {
+		var p listedPackage
+		if err := dec.Decode(&p); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("decode go list output: %w", err)
+		}
+		packages = append(packages, p)
+	}
+	return packages, nil
+}
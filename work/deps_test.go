@@ -0,0 +1,127 @@
+package work
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDepGraph(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"go.mod":                "module example.com/m\n\ngo 1.24\n",
+		"cmd/api/main.go":       "package main\n\nimport _ \"example.com/m/shared\"\n\nfunc main() {}\n",
+		"cmd/worker/main.go":    "package main\n\nfunc main() {}\n",
+		"shared/shared.go":      "package shared\n\nimport _ \"embed\"\n\n//go:embed page.html\nvar Page string\n",
+		"shared/page.html":      "<p>hi</p>\n",
+		"shared/shared_test.go": "package shared\n",
+		"other/other.go":        "package other\n",
+		"config.yaml":           "a: 1\n",
+	})
+
+	api := filepath.Join(dir, "cmd/api")
+	worker := filepath.Join(dir, "cmd/worker")
+	g := NewDepGraph()
+	g.AddRoot(api, nil)
+	g.AddRoot(worker, nil)
+	if err := g.Load(context.Background()); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	tests := []struct {
+		file      string
+		api, work bool
+	}{
+		{"cmd/api/main.go", true, false},
+		{"cmd/worker/main.go", false, true},
+		{"shared/shared.go", true, false},
+		{"shared/page.html", true, false},
+		{"shared/shared_test.go", false, false},
+		{"other/other.go", false, false},
+		{"config.yaml", true, true},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(dir, tt.file)
+		if got := g.Affects(api, path); got != tt.api {
+			t.Errorf("Affects(api, %s) = %v, want %v", tt.file, got, tt.api)
+		}
+		if got := g.Affects(worker, path); got != tt.work {
+			t.Errorf("Affects(worker, %s) = %v, want %v", tt.file, got, tt.work)
+		}
+	}
+
+	// A new import of a package the worker didn't depend on reloads the graph
+	writeFiles(t, dir, map[string]string{
+		"cmd/worker/main.go": "package main\n\nimport _ \"example.com/m/other\"\n\nfunc main() {}\n",
+	})
+	if !g.Invalidate([]string{filepath.Join(dir, "cmd/worker/main.go")}) {
+		t.Fatal("Invalidate() = false after a new import, want true")
+	}
+	// Until the graph is loaded again every file affects every target
+	if !g.Affects(api, filepath.Join(dir, "cmd/worker/main.go")) {
+		t.Error("api not affected by cmd/worker/main.go while the graph is invalidated")
+	}
+	if err := g.Load(context.Background()); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if !g.Affects(worker, filepath.Join(dir, "other/other.go")) {
+		t.Error("worker not affected by other/other.go after reload")
+	}
+	if g.Affects(api, filepath.Join(dir, "cmd/worker/main.go")) {
+		t.Error("api affected by cmd/worker/main.go after reload")
+	}
+	if g.Invalidate([]string{filepath.Join(dir, "other/other.go"), filepath.Join(dir, "config.yaml")}) {
+		t.Error("Invalidate() = true without a new import")
+	}
+}
+
+func TestAffectedPackages(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"go.mod":                 "module example.com/m\n\ngo 1.24\n",
+		"base/base.go":           "package base\n",
+		"mid/mid.go":             "package mid\n\nimport _ \"example.com/m/base\"\n",
+		"top/top.go":             "package top\n\nimport _ \"example.com/m/mid\"\n",
+		"top/top_test.go":        "package top\n",
+		"top/testdata/in.txt":    "input\n",
+		"other/other.go":         "package other\n",
+		"other/other_test.go":    "package other\n\nimport _ \"example.com/m/base\"\n",
+		"unrelated/unrelated.go": "package unrelated\n",
+	})
+	t.Chdir(dir)
+
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{"base/base.go", []string{"example.com/m/base", "example.com/m/mid", "example.com/m/other", "example.com/m/top"}},
+		{"mid/mid.go", []string{"example.com/m/mid", "example.com/m/top"}},
+		{"top/top_test.go", []string{"example.com/m/top"}},
+		{"top/testdata/in.txt", []string{"example.com/m/top"}},
+		{"unrelated/unrelated.go", []string{"example.com/m/unrelated"}},
+	}
+	for _, tt := range tests {
+		got, err := AffectedPackages(context.Background(), []string{"./..."}, nil, []string{tt.path})
+		if err != nil {
+			t.Fatalf("AffectedPackages(%s) error = %v", tt.path, err)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("AffectedPackages(%s) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
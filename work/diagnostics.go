@@ -0,0 +1,89 @@
+package work
+
+import (
+	"bufio"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BuildResult describes the outcome of a build
+type BuildResult struct {
+	// Output is the combined stdout and stderr of go build
+	Output string `json:"output,omitempty"`
+	// Diagnostics are the compiler errors parsed from Output
+	Diagnostics []Diagnostic `json:"diagnostics,omitempty"`
+	// Duration is how long the prebuild command and go build took
+	Duration time.Duration `json:"duration"`
+}
+
+// Diagnostic is a single compiler error reported by go build
+type Diagnostic struct {
+	// Package is the import path of the package being compiled, if known
+	Package string `json:"package,omitempty"`
+	// File is the absolute path of the file the error was reported in
+	File string `json:"file"`
+	// Line is the 1-based line number
+	Line int `json:"line"`
+	// Column is the 1-based column number, 0 if go build didn't report one
+	Column int `json:"column,omitempty"`
+	// Message is the error message, including any indented continuation lines
+	Message string `json:"message"`
+}
+
+func (d Diagnostic) String() string {
+	if d.Column > 0 {
+		return fmt.Sprintf("%s:%d:%d: %s", d.File, d.Line, d.Column, d.Message)
+	}
+	return fmt.Sprintf("%s:%d: %s", d.File, d.Line, d.Message)
+}
+
+// diagnosticPattern matches "file.go:line:col: message" and "file.go:line: message".
+// The lazy file group keeps Windows drive letters in the path.
+var diagnosticPattern = regexp.MustCompile(`^(.+?\.go):(\d+)(?::(\d+))?: (.*)$`)
+
+// parseDiagnostics extracts compiler errors from go build output. Relative file
+// paths are resolved against dir.
+func parseDiagnostics(output, dir string) []Diagnostic {
+	var (
+		diagnostics []Diagnostic
+		pkg         string
+	)
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+
+		switch {
+		case strings.HasPrefix(line, "# "):
+			pkg = strings.TrimPrefix(line, "# ")
+		case strings.HasPrefix(line, "\t") && len(diagnostics) > 0:
+			last := &diagnostics[len(diagnostics)-1]
+			last.Message += "\n" + strings.TrimPrefix(line, "\t")
+		default:
+			m := diagnosticPattern.FindStringSubmatch(line)
+			if m == nil {
+				continue
+			}
+
+			file := m[1]
+			if !filepath.IsAbs(file) {
+				file = filepath.Join(dir, file)
+			}
+			lineNum, _ := strconv.Atoi(m[2])
+			col, _ := strconv.Atoi(m[3])
+
+			diagnostics = append(diagnostics, Diagnostic{
+				Package: pkg,
+				File:    file,
+				Line:    lineNum,
+				Column:  col,
+				Message: m[4],
+			})
+		}
+	}
+	return diagnostics
+}
@@ -0,0 +1,61 @@
+package work
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseDiagnostics(t *testing.T) {
+	dir := filepath.FromSlash("/src/app")
+
+	output := `# example.com/app/internal/api
+internal/api/handler.go:12:2: undefined: foo
+internal/api/handler.go:20: missing return
+# example.com/app
+./main.go:7:15: cannot use x (variable of type int) as string value in argument to f
+	have (int)
+	want (string)
+go: some unrelated line
+`
+
+	want := []Diagnostic{
+		{
+			Package: "example.com/app/internal/api",
+			File:    filepath.Join(dir, "internal/api/handler.go"),
+			Line:    12,
+			Column:  2,
+			Message: "undefined: foo",
+		},
+		{
+			Package: "example.com/app/internal/api",
+			File:    filepath.Join(dir, "internal/api/handler.go"),
+			Line:    20,
+			Message: "missing return",
+		},
+		{
+			Package: "example.com/app",
+			File:    filepath.Join(dir, "main.go"),
+			Line:    7,
+			Column:  15,
+			Message: "cannot use x (variable of type int) as string value in argument to f\nhave (int)\nwant (string)",
+		},
+	}
+
+	got := parseDiagnostics(output, dir)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseDiagnostics() =\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestDiagnostic_String(t *testing.T) {
+	d := Diagnostic{File: "main.go", Line: 3, Column: 4, Message: "oops"}
+	if got := d.String(); got != "main.go:3:4: oops" {
+		t.Errorf("String() = %q", got)
+	}
+
+	d.Column = 0
+	if got := d.String(); got != "main.go:3: oops" {
+		t.Errorf("String() = %q", got)
+	}
+}
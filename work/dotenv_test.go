@@ -0,0 +1,58 @@
+package work
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseDotenv(t *testing.T) {
+	input := "\ufeff# comment\n" +
+		"\n" +
+		"PLAIN=value\n" +
+		"export EXPORTED=yes\n" +
+		"SPACED = padded \n" +
+		"COMMENTED=value # trailing\n" +
+		"HASH=a#b\n" +
+		"SINGLE='raw \\n # kept'\n" +
+		"DOUBLE=\"line\\nbreak \\\"quoted\\\"\"\n" +
+		"EMPTY=\n"
+
+	got, err := parseDotenv(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseDotenv() error = %v", err)
+	}
+
+	want := []string{
+		"PLAIN=value",
+		"EXPORTED=yes",
+		"SPACED=padded",
+		"COMMENTED=value",
+		"HASH=a#b",
+		`SINGLE=raw \n # kept`,
+		"DOUBLE=line\nbreak \"quoted\"",
+		"EMPTY=",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("parseDotenv() = %q, want %q", got, want)
+	}
+}
+
+func TestParseDotenv_Errors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"missing equals", "KEY\n"},
+		{"missing key", "=value\n"},
+		{"unterminated quote", "KEY=\"value\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseDotenv(strings.NewReader(tt.input)); err == nil {
+				t.Error("parseDotenv() error = nil, want error")
+			}
+		})
+	}
+}
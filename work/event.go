@@ -0,0 +1,56 @@
+package work
+
+import (
+	"time"
+)
+
+// EventType identifies a lifecycle stage reported through an EventHandler
+type EventType string
+
+const (
+	EventChange        EventType = "change"
+	EventPrebuildStart EventType = "prebuild_start"
+	EventPrebuildEnd   EventType = "prebuild_end"
+	EventCommandStart  EventType = "command_start"
+	EventCommandEnd    EventType = "command_end"
+	EventBuildStart    EventType = "build_start"
+	EventBuildSuccess  EventType = "build_success"
+	EventBuildFailure  EventType = "build_failure"
+	EventProcessStart  EventType = "process_start"
+	EventProcessExit   EventType = "process_exit"
+	EventReady         EventType = "ready"
+	EventNotReady      EventType = "not_ready"
+	EventRestart       EventType = "restart"
+	EventCrashLoop     EventType = "crash_loop"
+)
+
+// Event describes a lifecycle stage of a build or process. Only the fields
+// relevant to the event type are set.
+type Event struct {
+	Type        EventType    `json:"type"`
+	Time        time.Time    `json:"time"`
+	Target      string       `json:"target,omitempty"`
+	Paths       []string     `json:"paths,omitempty"`
+	Package     string       `json:"package,omitempty"`
+	Command     string       `json:"command,omitempty"`
+	DurationMS  int64        `json:"duration_ms,omitempty"`
+	Cached      bool         `json:"cached,omitempty"`
+	Error       string       `json:"error,omitempty"`
+	Diagnostics []Diagnostic `json:"diagnostics,omitempty"`
+	PID         int          `json:"pid,omitempty"`
+	ExitCode    *int         `json:"exit_code,omitempty"`
+	Attempt     int          `json:"attempt,omitempty"`
+}
+
+// EventHandler receives lifecycle events. It is called synchronously and must not block.
+type EventHandler func(Event)
+
+// Emit stamps the event with the current time and passes it to the handler.
+// It is safe to call on a nil handler.
+func (h EventHandler) Emit(e Event) {
+	if h == nil {
+		return
+	}
+	e.Time = time.Now()
+	h(e)
+}
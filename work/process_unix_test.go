@@ -0,0 +1,97 @@
+//go:build unix
+
+package work
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRunner_StopKillsProcessGroup(t *testing.T) {
+	pidFile := filepath.Join(t.TempDir(), "pid")
+	exited := make(chan struct{}, 1)
+	r := NewRunner(t.TempDir(), "sh", []string{"-c", "sleep 60 & echo $! > " + pidFile + "; wait"},
+		WithProcessOutput(io.Discard),
+		WithProcessLogger(log.New(io.Discard, "", 0)),
+		WithStopTimeout(time.Second),
+		WithProcessEvents(func(e Event) {
+			if e.Type == EventProcessExit {
+				exited <- struct{}{}
+			}
+		}),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.Listen(ctx)
+	r.Refresh()
+
+	var pid int
+	deadline := time.Now().Add(5 * time.Second)
+	for pid == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("grandchild never started")
+		}
+		time.Sleep(10 * time.Millisecond)
+		b, err := os.ReadFile(pidFile)
+		if err == nil && strings.HasSuffix(string(b), "\n") {
+			pid, _ = strconv.Atoi(strings.TrimSpace(string(b)))
+		}
+	}
+
+	r.Stop()
+	select {
+	case <-exited:
+	case <-time.After(5 * time.Second):
+		t.Fatal("process did not exit after Stop()")
+	}
+
+	// Killed processes may linger as zombies until init reaps them
+	if out, err := exec.Command("ps", "-o", "stat=", "-p", strconv.Itoa(pid)).Output(); err == nil && !strings.HasPrefix(strings.TrimSpace(string(out)), "Z") {
+		t.Errorf("grandchild %d still running after Stop(): %s", pid, out)
+	}
+}
+
+func TestRunner_ShutdownCommandSharesStopTimeout(t *testing.T) {
+	exited := make(chan struct{}, 1)
+	stopTimeout := 500 * time.Millisecond
+	r := NewRunner(t.TempDir(), "sleep", []string{"60"},
+		WithProcessOutput(io.Discard),
+		WithProcessLogger(log.New(io.Discard, "", 0)),
+		WithStopSignal(syscall.SIGCONT), // Ignored by sleep, only the kill stops it
+		WithStopTimeout(stopTimeout),
+		WithShutdownCommand("exec sleep 10"),
+		WithProcessEvents(func(e Event) {
+			if e.Type == EventProcessExit {
+				exited <- struct{}{}
+			}
+		}),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.Listen(ctx)
+	r.Refresh()
+	time.Sleep(100 * time.Millisecond)
+
+	start := time.Now()
+	r.Stop()
+	select {
+	case <-exited:
+	case <-time.After(5 * time.Second):
+		t.Fatal("process did not exit after Stop()")
+	}
+	// A shutdown command that hangs uses up the stop timeout, it doesn't add to it
+	if elapsed := time.Since(start); elapsed > stopTimeout+300*time.Millisecond {
+		t.Errorf("Stop() took %s with a stop timeout of %s", elapsed, stopTimeout)
+	}
+}
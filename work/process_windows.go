@@ -0,0 +1,48 @@
+//go:build windows
+
+package work
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+var signals = map[string]syscall.Signal{
+	"INT":  syscall.SIGINT,
+	"KILL": syscall.SIGKILL,
+	"TERM": syscall.SIGTERM,
+}
+
+// ParseSignal parses a signal name such as SIGTERM, TERM or term
+func ParseSignal(name string) (os.Signal, error) {
+	sig, ok := signals[strings.TrimPrefix(strings.ToUpper(name), "SIG")]
+	if !ok {
+		return nil, fmt.Errorf("unsupported signal %q", name)
+	}
+	return sig, nil
+}
+
+// setProcessGroup places the process in its own process group so the whole
+// tree it spawns can be signaled at once
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP}
+}
+
+// terminateProcessGroup kills the process tree of p. Windows can't deliver sig
+// to another console process group, so the tree is killed right away.
+func terminateProcessGroup(p *os.Process, _ os.Signal) error {
+	return killProcessGroup(p)
+}
+
+// killProcessGroup forcefully kills the process tree of p
+func killProcessGroup(p *os.Process) error {
+	err := exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(p.Pid)).Run()
+	if err != nil {
+		return p.Kill()
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package work
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"sync"
+	"time"
+)
+
+const (
+	defaultReadyTimeout  = 10 * time.Second
+	readyPollingInterval = 100 * time.Millisecond
+)
+
+// ReadinessProbe describes how to tell that a started process accepts traffic.
+// Every configured check has to pass for the process to be considered ready.
+type ReadinessProbe struct {
+	// TCPAddr is an address that has to accept TCP connections, e.g. localhost:8080
+	TCPAddr string
+	// HTTPURL is a URL that has to answer a GET request with HTTPStatus
+	HTTPURL string
+	// HTTPStatus is the expected status code of HTTPURL, defaults to 200
+	HTTPStatus int
+	// LogPattern has to match a line written by the process to stdout or stderr
+	LogPattern *regexp.Regexp
+	// Timeout is how long to wait for the process to become ready, defaults to 10s
+	Timeout time.Duration
+}
+
+// Enabled reports whether any check is configured
+func (p ReadinessProbe) Enabled() bool {
+	return p.TCPAddr != "" || p.HTTPURL != "" || p.LogPattern != nil
+}
+
+// wait blocks until every configured check passes, the timeout expires or ctx is done.
+// logMatched is closed once the log pattern matched.
+func (p ReadinessProbe) wait(ctx context.Context, logMatched <-chan struct{}) error {
+	timeout := p.Timeout
+	if timeout <= 0 {
+		timeout = defaultReadyTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if p.LogPattern != nil {
+		select {
+		case <-logMatched:
+		case <-ctx.Done():
+			return fmt.Errorf("log pattern %q not matched: %w", p.LogPattern, ctx.Err())
+		}
+	}
+
+	if p.TCPAddr != "" {
+		err := poll(ctx, func() error {
+			conn, err := (&net.Dialer{Timeout: readyPollingInterval}).DialContext(ctx, "tcp", p.TCPAddr)
+			if err != nil {
+				return err
+			}
+			return conn.Close()
+		})
+		if err != nil {
+			return fmt.Errorf("tcp %s: %w", p.TCPAddr, err)
+		}
+	}
+
+	if p.HTTPURL != "" {
+		status := p.HTTPStatus
+		if status == 0 {
+			status = http.StatusOK
+		}
+		err := poll(ctx, func() error {
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.HTTPURL, nil)
+			if err != nil {
+				return err
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				return err
+			}
+			resp.Body.Close()
+			if resp.StatusCode != status {
+				return fmt.Errorf("got status %d, want %d", resp.StatusCode, status)
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("http %s: %w", p.HTTPURL, err)
+		}
+	}
+
+	return nil
+}
+
+// poll calls check until it succeeds or ctx is done, returning the last check error
+func poll(ctx context.Context, check func() error) error {
+	ticker := time.NewTicker(readyPollingInterval)
+	defer ticker.Stop()
+
+	for {
+		err := check()
+		if err == nil {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w: %w", ctx.Err(), err)
+		case <-ticker.C:
+		}
+	}
+}
+
+// lineMatcher closes matched once a line written to any of its writers matches pattern
+type lineMatcher struct {
+	pattern *regexp.Regexp
+	matched chan struct{}
+	once    sync.Once
+}
+
+func newLineMatcher(pattern *regexp.Regexp) *lineMatcher {
+	return &lineMatcher{
+		pattern: pattern,
+		matched: make(chan struct{}),
+	}
+}
+
+// writer returns an io.Writer for a single output stream
+func (m *lineMatcher) writer() io.Writer {
+	return &lineWriter{matcher: m}
+}
+
+// lineWriter splits a single output stream into lines for a lineMatcher
+type lineWriter struct {
+	matcher *lineMatcher
+	buf     []byte
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	select {
+	case <-w.matcher.matched:
+		return len(p), nil
+	default:
+	}
+
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		line := w.buf[:i]
+		w.buf = w.buf[i+1:]
+
+		if w.matcher.pattern.Match(line) {
+			w.buf = nil
+			w.matcher.once.Do(func() { close(w.matcher.matched) })
+			break
+		}
+	}
+	return len(p), nil
+}
@@ -0,0 +1,114 @@
+package work
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReadinessProbe_TCP(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+
+	probe := ReadinessProbe{TCPAddr: addr, Timeout: time.Second}
+	if err := probe.wait(context.Background(), nil); err != nil {
+		t.Errorf("wait() error = %v", err)
+	}
+
+	l.Close()
+	probe.Timeout = 300 * time.Millisecond
+	if err := probe.wait(context.Background(), nil); err == nil {
+		t.Error("wait() on a closed port succeeded")
+	}
+}
+
+func TestReadinessProbe_HTTP(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Unavailable until the third request
+		if requests.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	probe := ReadinessProbe{HTTPURL: srv.URL, HTTPStatus: http.StatusNoContent, Timeout: 2 * time.Second}
+	if err := probe.wait(context.Background(), nil); err != nil {
+		t.Fatalf("wait() error = %v", err)
+	}
+	if n := requests.Load(); n != 3 {
+		t.Errorf("wait() made %d requests, want 3", n)
+	}
+
+	// The default expected status is 200
+	probe = ReadinessProbe{HTTPURL: srv.URL, Timeout: 300 * time.Millisecond}
+	if err := probe.wait(context.Background(), nil); err == nil {
+		t.Error("wait() succeeded with status 204, want 200")
+	}
+}
+
+func TestLineMatcher(t *testing.T) {
+	m := newLineMatcher(regexp.MustCompile(`listening on :\d+$`))
+	stdout, stderr := m.writer(), m.writer()
+
+	matched := func() bool {
+		select {
+		case <-m.matched:
+			return true
+		default:
+			return false
+		}
+	}
+
+	// Lines are split per stream, a line isn't completed by another stream
+	stdout.Write([]byte("starting\nlistening on"))
+	stderr.Write([]byte(" :8080\n"))
+	if matched() {
+		t.Fatal("matched a line split across stdout and stderr")
+	}
+
+	stderr.Write([]byte("listen"))
+	stderr.Write([]byte("ing on :80"))
+	if matched() {
+		t.Fatal("matched an unterminated line")
+	}
+	stderr.Write([]byte("80\nmore\n"))
+	if !matched() {
+		t.Fatal("line split across writes not matched")
+	}
+
+	// Writes after the match are accepted and ignored
+	if n, err := stdout.Write([]byte("listening on :1\n")); n != 16 || err != nil {
+		t.Errorf("Write() after match = %d, %v", n, err)
+	}
+}
+
+func TestReadinessProbe_Timeout(t *testing.T) {
+	m := newLineMatcher(regexp.MustCompile("ready"))
+	probe := ReadinessProbe{LogPattern: m.pattern, Timeout: 50 * time.Millisecond}
+
+	start := time.Now()
+	err := probe.wait(context.Background(), m.matched)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("wait() error = %v, want deadline exceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("wait() took %s with a 50ms timeout", elapsed)
+	}
+
+	m.writer().Write([]byte("server ready\n"))
+	if err := probe.wait(context.Background(), m.matched); err != nil {
+		t.Errorf("wait() after the log line error = %v", err)
+	}
+}
@@ -0,0 +1,71 @@
+package work
+
+import (
+	"fmt"
+	"time"
+)
+
+// RestartMode decides whether a process that exited on its own is restarted
+type RestartMode string
+
+const (
+	RestartNever     RestartMode = "never"
+	RestartOnFailure RestartMode = "on-failure"
+	RestartAlways    RestartMode = "always"
+)
+
+// ParseRestartMode parses never, on-failure or always
+func ParseRestartMode(s string) (RestartMode, error) {
+	switch m := RestartMode(s); m {
+	case RestartNever, RestartOnFailure, RestartAlways:
+		return m, nil
+	case "":
+		return RestartNever, nil
+	default:
+		return "", fmt.Errorf("unsupported restart policy %q, want never, on-failure or always", s)
+	}
+}
+
+const (
+	defaultRestartBackoff = 500 * time.Millisecond
+	maxRestartBackoff     = 30 * time.Second
+
+	// stableUptime is how long a process has to run before its restart count
+	// is reset, anything shorter counts towards a crash loop
+	stableUptime = 10 * time.Second
+)
+
+// RestartPolicy describes how processes that exit on their own are restarted
+type RestartPolicy struct {
+	Mode RestartMode
+	// MaxRetries is how many consecutive restarts of a crashing process are
+	// attempted before giving up, 0 means no limit
+	MaxRetries int
+	// Backoff is the delay before the first restart. It doubles with every
+	// consecutive restart up to 30s. Defaults to 500ms.
+	Backoff time.Duration
+}
+
+// shouldRestart reports whether a process that exited with err is restarted
+func (p RestartPolicy) shouldRestart(err error) bool {
+	switch p.Mode {
+	case RestartAlways:
+		return true
+	case RestartOnFailure:
+		return err != nil
+	default:
+		return false
+	}
+}
+
+// backoff returns the delay before the given 1-based restart attempt
+func (p RestartPolicy) backoff(attempt int) time.Duration {
+	d := p.Backoff
+	if d <= 0 {
+		d = defaultRestartBackoff
+	}
+	for i := 1; i < attempt && d < maxRestartBackoff; i++ {
+		d *= 2
+	}
+	return min(d, maxRestartBackoff)
+}
@@ -0,0 +1,59 @@
+package work
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRestartPolicy_Backoff(t *testing.T) {
+	p := RestartPolicy{Backoff: time.Second}
+
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{6, 30 * time.Second},
+		{100, 30 * time.Second},
+	}
+
+	for _, tt := range tests {
+		if got := p.backoff(tt.attempt); got != tt.want {
+			t.Errorf("backoff(%d) = %s, want %s", tt.attempt, got, tt.want)
+		}
+	}
+}
+
+func TestRestartPolicy_ShouldRestart(t *testing.T) {
+	failure := errors.New("exit status 1")
+
+	tests := []struct {
+		mode RestartMode
+		err  error
+		want bool
+	}{
+		{RestartNever, failure, false},
+		{RestartOnFailure, failure, true},
+		{RestartOnFailure, nil, false},
+		{RestartAlways, nil, true},
+	}
+
+	for _, tt := range tests {
+		p := RestartPolicy{Mode: tt.mode}
+		if got := p.shouldRestart(tt.err); got != tt.want {
+			t.Errorf("%s shouldRestart(%v) = %v, want %v", tt.mode, tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestParseRestartMode(t *testing.T) {
+	if m, err := ParseRestartMode(""); err != nil || m != RestartNever {
+		t.Errorf("ParseRestartMode(\"\") = %q, %v", m, err)
+	}
+	if _, err := ParseRestartMode("sometimes"); err == nil {
+		t.Error("Expected error for unsupported restart policy")
+	}
+}
@@ -7,7 +7,8 @@ import (
 	"log"
 	"os"
 	"os/exec"
-	"runtime"
+	"strconv"
+	"sync"
 	"time"
 )
 
@@ -15,19 +16,142 @@ type Runner struct {
 	binPath    string
 	workingDir string
 	args       []string
+	env        []string
+	envFiles   []string
+	readiness  ReadinessProbe
+	onReady    func(err error)
+	stdin      io.Reader
+	debugAddr  string
+	coverage   *Coverage
+	output     io.Writer
+	events     EventHandler
+	logger     *log.Logger
+
+	stopSignal  os.Signal
+	stopTimeout time.Duration
+	shutdownCmd string
+	restart     RestartPolicy
 
 	refreshSignal chan struct{}
-	stopSignal    chan struct{}
+	stopCh        chan struct{}
+
+	// stdinMu guards processStdin, the stdin pipe of the running process
+	stdinMu      sync.Mutex
+	processStdin io.WriteCloser
+}
+
+// RunnerOption defines a function type for configuring Runner
+type RunnerOption func(*Runner)
+
+// WithEnv sets additional KEY=VALUE environment variables for the process on
+// top of the environment inherited from pulse
+func WithEnv(env []string) RunnerOption {
+	return func(r *Runner) {
+		r.env = env
+	}
+}
+
+// WithEnvFiles sets dotenv files loaded every time a process starts. Their
+// variables override the inherited environment and are overridden by WithEnv.
+func WithEnvFiles(paths []string) RunnerOption {
+	return func(r *Runner) {
+		r.envFiles = paths
+	}
+}
+
+// WithReadiness sets the probe used to tell when a started process accepts traffic
+func WithReadiness(probe ReadinessProbe) RunnerOption {
+	return func(r *Runner) {
+		r.readiness = probe
+	}
+}
+
+// WithOnReady sets a callback invoked once a started process passed its
+// readiness probe, or failed it with a non-nil error. Without a probe the
+// callback is invoked right after the process started.
+func WithOnReady(onReady func(err error)) RunnerOption {
+	return func(r *Runner) {
+		r.onReady = onReady
+	}
 }
 
-func NewRunner(workingDir string, binPath string, args []string) *Runner {
-	return &Runner{
+// WithStdin forwards input read from stdin to the running process, which gets
+// no input by default. Input arriving while no process runs is dropped.
+func WithStdin(stdin io.Reader) RunnerOption {
+	return func(r *Runner) {
+		r.stdin = stdin
+	}
+}
+
+// WithProcessOutput sets where the process stdout and stderr are written, defaults to os.Stdout
+func WithProcessOutput(w io.Writer) RunnerOption {
+	return func(r *Runner) {
+		r.output = w
+	}
+}
+
+// WithProcessEvents sets the handler receiving process start, exit and readiness events
+func WithProcessEvents(handler EventHandler) RunnerOption {
+	return func(r *Runner) {
+		r.events = handler
+	}
+}
+
+// WithProcessLogger sets the logger for process lifecycle messages, defaults to the standard logger
+func WithProcessLogger(logger *log.Logger) RunnerOption {
+	return func(r *Runner) {
+		r.logger = logger
+	}
+}
+
+// WithStopSignal sets the signal sent to the process group to stop it, defaults to os.Interrupt
+func WithStopSignal(sig os.Signal) RunnerOption {
+	return func(r *Runner) {
+		r.stopSignal = sig
+	}
+}
+
+// WithStopTimeout sets how long a stopping process may take to shut down
+// gracefully before it is killed, shutdown command included, defaults to 3s
+func WithStopTimeout(timeout time.Duration) RunnerOption {
+	return func(r *Runner) {
+		r.stopTimeout = timeout
+	}
+}
+
+// WithShutdownCommand sets a shell command that asks the process to shut down,
+// e.g. a curl call to a /shutdown endpoint. It is run instead of sending the
+// stop signal, which is only sent if the command fails.
+func WithShutdownCommand(command string) RunnerOption {
+	return func(r *Runner) {
+		r.shutdownCmd = command
+	}
+}
+
+// WithRestartPolicy sets how processes that exit on their own are restarted
+func WithRestartPolicy(policy RestartPolicy) RunnerOption {
+	return func(r *Runner) {
+		r.restart = policy
+	}
+}
+
+func NewRunner(workingDir string, binPath string, args []string, options ...RunnerOption) *Runner {
+	r := &Runner{
 		binPath:       binPath,
 		workingDir:    workingDir,
-		refreshSignal: make(chan struct{}),
-		stopSignal:    make(chan struct{}),
+		refreshSignal: make(chan struct{}, 1),
+		stopCh:        make(chan struct{}, 1),
 		args:          args,
+		output:        os.Stdout,
+		logger:        log.Default(),
+		stopSignal:    os.Interrupt,
+		stopTimeout:   3 * time.Second,
 	}
+
+	for _, option := range options {
+		option(r)
+	}
+	return r
 }
 
 func (r *Runner) Refresh() {
@@ -39,75 +163,299 @@ func (r *Runner) Refresh() {
 
 func (r *Runner) Stop() {
 	select {
-	case r.stopSignal <- struct{}{}:
+	case r.stopCh <- struct{}{}:
 	default:
 	}
 }
 
+// processExit reports a process that exited without being stopped
+type processExit struct {
+	generation int
+	uptime     time.Duration
+	err        error
+}
+
 func (r *Runner) Listen(ctx context.Context) {
-	var stopProcess context.CancelFunc = func() {}
+	if r.stdin != nil {
+		go r.forwardStdin()
+	}
+
+	var (
+		stopProcess  = func() {}
+		exited       = make(chan processExit, 1)
+		generation   int
+		restarts     int
+		restartTimer *time.Timer
+		restartC     <-chan time.Time
+	)
+
+	cancelRestart := func() {
+		if restartTimer != nil {
+			restartTimer.Stop()
+		}
+		restartTimer, restartC = nil, nil
+	}
+
+	start := func() {
+		generation++
+		gen := generation
+
+		// Start a new process. Stopping it waits for the exit so the
+		// next process never races the previous one for its resources.
+		processCtx, cancel := context.WithCancel(ctx)
+		done := make(chan struct{})
+		stopProcess = func() {
+			cancel()
+			<-done
+		}
+		go func() {
+			defer close(done)
+
+			started := time.Now()
+			err := r.startProcess(processCtx)
+			if processCtx.Err() != nil {
+				return // Stopped on purpose
+			}
+
+			var xe *exec.ExitError
+			if err != nil && !errors.As(err, &xe) {
+				r.logger.Printf("[Runner] failed to start process: %v\n", err)
+			}
+			select {
+			case exited <- processExit{generation: gen, uptime: time.Since(started), err: err}:
+			case <-ctx.Done():
+			}
+		}()
+	}
 
 	for {
 		select {
 		case <-ctx.Done():
+			cancelRestart()
 			stopProcess()
 			return
-		case <-r.stopSignal:
+		case <-r.stopCh:
+			cancelRestart()
 			stopProcess()
 		case <-r.refreshSignal:
+			cancelRestart()
 			stopProcess()
+			restarts = 0
+			start()
+		case exit := <-exited:
+			if exit.generation != generation || !r.restart.shouldRestart(exit.err) {
+				continue
+			}
+			if exit.uptime >= stableUptime {
+				restarts = 0
+			}
+			restarts++
+
+			if r.restart.MaxRetries > 0 && restarts > r.restart.MaxRetries {
+				r.logger.Printf("[Runner] process is crash looping, gave up after %d restarts. Waiting for the next change.\n", r.restart.MaxRetries)
+				r.events.Emit(Event{Type: EventCrashLoop, Attempt: restarts - 1})
+				continue
+			}
 
-			// Start a new process.
-			var processCtx context.Context
-			processCtx, stopProcess = context.WithCancel(ctx)
-			go func() {
-				if err := r.startProcess(processCtx); err != nil {
-					log.Printf("[Runner] failed to start process: %v\n", err)
-				}
-			}()
+			backoff := r.restart.backoff(restarts)
+			r.logger.Printf("[Runner] restarting in %s (attempt %d)\n", backoff, restarts)
+			r.events.Emit(Event{Type: EventRestart, Attempt: restarts, DurationMS: backoff.Milliseconds()})
+			restartTimer = time.NewTimer(backoff)
+			restartC = restartTimer.C
+		case <-restartC:
+			restartTimer, restartC = nil, nil
+			start()
 		}
 	}
 }
 
 func (r *Runner) startProcess(ctx context.Context) error {
-	cmd := exec.CommandContext(ctx, r.binPath, r.args...)
+	name, args := r.binPath, r.args
+	if r.debugAddr != "" {
+		name, args = "dlv", debuggerArgs(r.debugAddr, r.binPath, r.args)
+	}
+	cmd := exec.CommandContext(ctx, name, args...)
 	cmd.Dir = r.workingDir
-	cmd.WaitDelay = 3 * time.Second
+	cmd.Env = r.environ()
+	if r.coverage != nil {
+		coverDir, err := r.coverage.runDir()
+		if err != nil {
+			return err
+		}
+		if cmd.Env == nil {
+			cmd.Env = os.Environ()
+		}
+		cmd.Env = append(cmd.Env, "GOCOVERDIR="+coverDir)
+		defer func() {
+			// The process is gone and ctx may be too, merging must still finish
+			if err := r.coverage.merge(context.WithoutCancel(ctx), coverDir); err != nil {
+				r.logger.Printf("[Runner] %v\n", err)
+			}
+		}()
+	}
+	// Signal the whole process group so subprocesses don't outlive a restart.
+	// Whatever is still running after WaitDelay is killed once Wait returns.
+	setProcessGroup(cmd)
+	cmd.WaitDelay = r.stopTimeout
 	cmd.Cancel = func() error {
-		if runtime.GOOS == "windows" {
-			return cmd.Process.Kill()
+		if r.shutdownCmd == "" {
+			return terminateProcessGroup(cmd.Process, r.stopSignal)
 		}
-		return cmd.Process.Signal(os.Interrupt)
+		// The WaitDelay timer only starts once Cancel returns, so the shutdown
+		// command runs in the background to share its deadline
+		go func() {
+			err := r.runShutdownCommand(cmd.Process.Pid)
+			if err == nil {
+				return
+			}
+			r.logger.Printf("[Runner] shutdown command failed, sending %v: %v\n", r.stopSignal, err)
+			if err := terminateProcessGroup(cmd.Process, r.stopSignal); err != nil && !errors.Is(err, os.ErrProcessDone) {
+				r.logger.Printf("[Runner] failed to stop process: %v\n", err)
+			}
+		}()
+		return nil
 	}
 
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		return err
+	if r.stdin != nil {
+		// The process is not in the foreground process group and can't read
+		// the terminal itself, so input is forwarded through a pipe
+		stdin, err := cmd.StdinPipe()
+		if err != nil {
+			return err
+		}
+		r.setProcessStdin(stdin)
+		defer r.setProcessStdin(nil)
 	}
-	stderr, err := cmd.StderrPipe()
+	cmd.Stdout, cmd.Stderr = r.output, r.output
+	var logMatched chan struct{}
+	if r.readiness.LogPattern != nil {
+		matcher := newLineMatcher(r.readiness.LogPattern)
+		cmd.Stdout = io.MultiWriter(r.output, matcher.writer())
+		cmd.Stderr = io.MultiWriter(r.output, matcher.writer())
+		logMatched = matcher.matched
+	}
+
+	start := time.Now()
+	err := cmd.Start()
 	if err != nil {
 		return err
 	}
+	r.events.Emit(Event{Type: EventProcessStart, Command: r.binPath, PID: cmd.Process.Pid})
 
-	go io.Copy(os.Stdout, stdout)
-	go io.Copy(os.Stdout, stderr)
+	if r.readiness.Enabled() || r.onReady != nil {
+		go r.awaitReady(ctx, start, logMatched)
+	}
 
-	err = cmd.Start()
+	err = cmd.Wait()
+	// Subprocesses left behind would keep holding ports for the next process
+	if err := killProcessGroup(cmd.Process); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		r.logger.Printf("[Runner] failed to kill process group: %v\n", err)
+	}
+	exitCode := cmd.ProcessState.ExitCode()
+	exit := Event{Type: EventProcessExit, PID: cmd.Process.Pid, ExitCode: &exitCode, DurationMS: time.Since(start).Milliseconds()}
 	if err != nil {
-		return err
+		exit.Error = err.Error()
 	}
+	r.events.Emit(exit)
 
-	err = cmd.Wait()
 	if err != nil {
 		var xe *exec.ExitError
 		switch {
 		case errors.As(err, &xe):
-			log.Printf("[Runner] process exited with code: %d\n", xe.ExitCode())
+			if ctx.Err() == nil {
+				r.logger.Printf("[Runner] process exited with code: %d\n", xe.ExitCode())
+			}
+			return err
 		case errors.Is(err, context.Canceled):
 			return nil
 		default:
 			return err
 		}
 	}
+	if ctx.Err() == nil {
+		r.logger.Println("[Runner] process exited with code: 0")
+	}
 	return nil
 }
+
+// awaitReady waits for the readiness probe to pass, logs how long it took and
+// notifies the ready callback
+func (r *Runner) awaitReady(ctx context.Context, start time.Time, logMatched <-chan struct{}) {
+	var err error
+	if r.readiness.Enabled() {
+		err = r.readiness.wait(ctx, logMatched)
+		elapsed := time.Since(start)
+		switch {
+		case err == nil:
+			r.logger.Printf("[Runner] ready in %s\n", elapsed.Round(time.Millisecond))
+			r.events.Emit(Event{Type: EventReady, DurationMS: elapsed.Milliseconds()})
+		case ctx.Err() != nil:
+			// Process was stopped before it became ready
+			return
+		default:
+			r.logger.Printf("[Runner] not ready after %s: %v\n", elapsed.Round(time.Millisecond), err)
+			r.events.Emit(Event{Type: EventNotReady, DurationMS: elapsed.Milliseconds(), Error: err.Error()})
+		}
+	}
+
+	if r.onReady != nil {
+		r.onReady(err)
+	}
+}
+
+// forwardStdin copies stdin to the running process until stdin is closed
+func (r *Runner) forwardStdin() {
+	buf := make([]byte, 4096)
+	for {
+		n, err := r.stdin.Read(buf)
+		if n > 0 {
+			r.stdinMu.Lock()
+			if r.processStdin != nil {
+				_, _ = r.processStdin.Write(buf[:n])
+			}
+			r.stdinMu.Unlock()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (r *Runner) setProcessStdin(w io.WriteCloser) {
+	r.stdinMu.Lock()
+	defer r.stdinMu.Unlock()
+	r.processStdin = w
+}
+
+// environ returns the environment for a new process, or nil to inherit the
+// environment of pulse as is. Env files are read again on every call so edits
+// take effect on the next restart.
+func (r *Runner) environ() []string {
+	if len(r.env) == 0 && len(r.envFiles) == 0 {
+		return nil
+	}
+
+	env := os.Environ()
+	for _, path := range r.envFiles {
+		vars, err := LoadEnvFile(path)
+		if err != nil {
+			r.logger.Printf("[Runner] failed to load env file: %v\n", err)
+			continue
+		}
+		env = append(env, vars...)
+	}
+	return append(env, r.env...)
+}
+
+// runShutdownCommand runs the shutdown command with PULSE_PID set to the pid of
+// the process being stopped
+func (r *Runner) runShutdownCommand(pid int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), r.stopTimeout)
+	defer cancel()
+
+	cmd := shellCommand(ctx, r.shutdownCmd)
+	cmd.Dir = r.workingDir
+	cmd.Env = append(os.Environ(), "PULSE_PID="+strconv.Itoa(pid))
+	cmd.Stdout, cmd.Stderr = r.output, r.output
+	return cmd.Run()
+}
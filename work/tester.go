@@ -0,0 +1,182 @@
+package work
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+)
+
+type Tester struct {
+	testArgs []string
+	output   io.Writer
+	logger   *log.Logger
+}
+
+// TesterOption defines a function type for configuring Tester
+type TesterOption func(*Tester)
+
+// WithTestOutput sets where the output of failing tests is written, defaults to os.Stdout
+func WithTestOutput(w io.Writer) TesterOption {
+	return func(t *Tester) {
+		t.output = w
+	}
+}
+
+// WithTestLogger sets the logger for test progress, defaults to the standard logger
+func WithTestLogger(logger *log.Logger) TesterOption {
+	return func(t *Tester) {
+		t.logger = logger
+	}
+}
+
+// NewTester returns a tester running go test with testArgs
+func NewTester(testArgs []string, options ...TesterOption) *Tester {
+	t := &Tester{
+		testArgs: testArgs,
+		output:   os.Stdout,
+		logger:   log.Default(),
+	}
+
+	for _, option := range options {
+		option(t)
+	}
+	return t
+}
+
+// PackageResult is the outcome of testing a package
+type PackageResult struct {
+	Package string
+	Passed  bool
+	// NoTests is set for packages without test files
+	NoTests bool
+	Elapsed time.Duration
+	// Failed holds the top level tests that failed
+	Failed []string
+}
+
+// testEvent is a go test -json event
+type testEvent struct {
+	Action     string
+	Package    string
+	ImportPath string
+	Test       string
+	Elapsed    float64
+	Output     string
+}
+
+// Test runs go test on packages, restricted to tests matching the run pattern
+// if it is not empty. Output is only shown for failing tests and packages that
+// failed to build. Failing tests don't make Test return an error.
+func (t *Tester) Test(ctx context.Context, packages []string, run string) ([]PackageResult, error) {
+	args := append([]string{"test", "-json"}, t.testArgs...)
+	if run != "" {
+		args = append(args, "-run", run)
+	}
+	cmd := exec.CommandContext(ctx, "go", append(args, packages...)...)
+	// Test binaries are children of go test, take them down with it
+	setProcessGroup(cmd)
+	cmd.Cancel = func() error { return killProcessGroup(cmd.Process) }
+	cmd.WaitDelay = time.Second
+	cmd.Stderr = t.output
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	t.logger.Printf("[Pulse] Testing %s\n", describePackages(packages))
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	var (
+		results []PackageResult
+		// output is buffered per package and test until the outcome is known
+		output = make(map[string]*bytes.Buffer)
+	)
+	buffer := func(key string) *bytes.Buffer {
+		if output[key] == nil {
+			output[key] = new(bytes.Buffer)
+		}
+		return output[key]
+	}
+	failed := make(map[string][]string)
+
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		var e testEvent
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			// Not an event, e.g. output of a test binary that failed to start
+			fmt.Fprintln(t.output, scanner.Text())
+			continue
+		}
+
+		key := e.Package + " " + e.Test
+		switch e.Action {
+		case "output":
+			buffer(key).WriteString(e.Output)
+		case "build-output":
+			buffer(e.ImportPath).WriteString(e.Output)
+		case "build-fail":
+			t.output.Write(buffer(e.ImportPath).Bytes())
+		case "fail":
+			if e.Test != "" {
+				if !strings.Contains(e.Test, "/") {
+					failed[e.Package] = append(failed[e.Package], e.Test)
+				}
+				t.output.Write(buffer(key).Bytes())
+				delete(output, key)
+				continue
+			}
+			if len(failed[e.Package]) == 0 {
+				// Failed outside of any test, e.g. in TestMain or at init
+				t.output.Write(buffer(key).Bytes())
+			}
+			fallthrough
+		case "pass", "skip":
+			if e.Test != "" {
+				delete(output, key)
+				continue
+			}
+			results = append(results, PackageResult{
+				Package: e.Package,
+				Passed:  e.Action != "fail",
+				NoTests: e.Action == "skip",
+				Elapsed: time.Duration(e.Elapsed * float64(time.Second)),
+				Failed:  failed[e.Package],
+			})
+			delete(output, key)
+		}
+	}
+
+	err = cmd.Wait()
+	if ctx.Err() != nil {
+		return results, ctx.Err()
+	}
+	if err != nil && len(results) == 0 {
+		return nil, fmt.Errorf("go test failed: %w", err)
+	}
+	slices.SortFunc(results, func(a, b PackageResult) int { return strings.Compare(a.Package, b.Package) })
+	return results, nil
+}
+
+// describePackages returns a short description of the packages for logging
+func describePackages(packages []string) string {
+	switch len(packages) {
+	case 1:
+		return packages[0]
+	case 2:
+		return packages[0] + " and " + packages[1]
+	default:
+		return fmt.Sprintf("%s and %d more", packages[0], len(packages)-1)
+	}
+}
@@ -0,0 +1,117 @@
+package work
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestTester_Test(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"go.mod":   "module example.com/m\n\ngo 1.24\n",
+		"ok/ok.go": "package ok\n",
+		"ok/ok_test.go": `package ok
+
+import "testing"
+
+func TestOK(t *testing.T) {
+	t.Log("ok output")
+	t.Run("sub", func(t *testing.T) {})
+}
+`,
+		"fail/fail.go": "package fail\n",
+		"fail/fail_test.go": `package fail
+
+import "testing"
+
+func TestSub(t *testing.T) {
+	t.Run("bad", func(t *testing.T) { t.Error("sub failure") })
+	t.Run("good", func(t *testing.T) {})
+}
+
+func TestTop(t *testing.T) { t.Error("top failure") }
+
+func TestPass(t *testing.T) { t.Log("pass output") }
+`,
+		"broken/broken.go":      "package broken\n",
+		"broken/broken_test.go": "package broken\n\nfunc TestBroken(t *testing.T) { undefined() }\n",
+		"setup/setup.go":        "package setup\n",
+		"setup/setup_test.go": `package setup
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	fmt.Println("setup failure")
+	os.Exit(1)
+}
+
+func TestNeverRuns(t *testing.T) {}
+`,
+		"notests/notests.go": "package notests\n",
+	})
+	t.Chdir(dir)
+
+	// A file, like os.Stdout, so go test writes its stderr to it directly
+	out, err := os.Create(filepath.Join(t.TempDir(), "output"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	tester := NewTester(nil, WithTestOutput(out), WithTestLogger(log.New(io.Discard, "", 0)))
+	results, err := tester.Test(context.Background(), []string{"./..."}, "")
+	if err != nil {
+		t.Fatalf("Test() error = %v", err)
+	}
+
+	want := []PackageResult{
+		{Package: "example.com/m/broken"},
+		{Package: "example.com/m/fail", Failed: []string{"TestSub", "TestTop"}},
+		{Package: "example.com/m/notests", Passed: true, NoTests: true},
+		{Package: "example.com/m/ok", Passed: true},
+		{Package: "example.com/m/setup"},
+	}
+	if len(results) != len(want) {
+		t.Fatalf("Test() returned %+v, want %d packages", results, len(want))
+	}
+	for i, r := range results {
+		w := want[i]
+		if r.Package != w.Package || r.Passed != w.Passed || r.NoTests != w.NoTests || !slices.Equal(r.Failed, w.Failed) {
+			t.Errorf("result %d = %+v, want %+v", i, r, w)
+		}
+	}
+
+	b, err := os.ReadFile(out.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := string(b)
+	// Only the output of failures is shown
+	for _, s := range []string{"sub failure", "top failure", "undefined: undefined", "setup failure"} {
+		if !strings.Contains(output, s) {
+			t.Errorf("output is missing %q:\n%s", s, output)
+		}
+	}
+	for _, s := range []string{"ok output", "pass output"} {
+		if strings.Contains(output, s) {
+			t.Errorf("output of a passing test %q shown:\n%s", s, output)
+		}
+	}
+
+	results, err = tester.Test(context.Background(), []string{"./fail"}, "^(TestPass)$")
+	if err != nil {
+		t.Fatalf("Test() error = %v", err)
+	}
+	if len(results) != 1 || !results[0].Passed {
+		t.Errorf("Test() with a run pattern = %+v, want fail to pass", results)
+	}
+}